@@ -0,0 +1,207 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// ArithmeticOptions controls how the results of image arithmetic outside the
+// range 0 to max are handled. By default they saturate.
+type ArithmeticOptions struct {
+	// Wrap takes the results modulo max+1 instead of saturating them.
+	Wrap bool
+	// Normalize maps the range of the results linearly onto 0 to max instead
+	// of saturating them. The range is shared by the three channels of a PPM
+	// image. It takes precedence over Wrap.
+	Normalize bool
+}
+
+// arithmetic combines pairs of planes of values from 0 to max with op and
+// returns the results as levels from 0 to max according to opts. With
+// Normalize, all the planes are mapped with the same range, so that the
+// channels of a color image keep their balance.
+func arithmetic(a, b [][][]float64, width, height int, max uint8, opts ArithmeticOptions, op func(a, b, max float64) float64) [][][]uint8 {
+	m := float64(max)
+	results := make([][][]float64, len(a))
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for c := range a {
+		results[c] = make([][]float64, height)
+		for y := 0; y < height; y++ {
+			results[c][y] = make([]float64, width)
+			for x := 0; x < width; x++ {
+				v := op(a[c][y][x], b[c][y][x], m)
+				results[c][y][x] = v
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+
+	out := make([][][]uint8, len(a))
+	for c := range results {
+		out[c] = make([][]uint8, height)
+		for y := 0; y < height; y++ {
+			out[c][y] = make([]uint8, width)
+			for x := 0; x < width; x++ {
+				v := results[c][y][x]
+				switch {
+				case opts.Normalize && hi > lo:
+					v = (v - lo) / (hi - lo) * m
+				case opts.Normalize:
+					// A constant result is only clamped
+				case opts.Wrap:
+					levels := m + 1
+					v = math.Mod(math.Round(v), levels)
+					if v < 0 {
+						v += levels
+					}
+				}
+				out[c][y][x] = clampUint8(v, max)
+			}
+		}
+	}
+	return out
+}
+
+// combine replaces the PGM image with op applied to its gray levels and
+// those of other, rescaled to the max value of the image.
+func (pgm *PGM) combine(other *PGM, opts ArithmeticOptions, op func(a, b, max float64) float64) error {
+	if other.width != pgm.width || other.height != pgm.height {
+		return fmt.Errorf("image sizes differ: %dx%d and %dx%d", pgm.width, pgm.height, other.width, other.height)
+	}
+	b := make([][]float64, other.height)
+	for y := range b {
+		b[y] = make([]float64, other.width)
+		for x := range b[y] {
+			b[y][x] = float64(rescale(other.data[y][x], other.max, pgm.max))
+		}
+	}
+	pgm.data = arithmetic([][][]float64{pgm.plane()}, [][][]float64{b}, pgm.width, pgm.height, pgm.max, opts, op)[0]
+	return nil
+}
+
+// combine replaces every channel of the PPM image with op applied to its
+// levels and those of the same channel of other, rescaled to the max value
+// of the image.
+func (ppm *PPM) combine(other *PPM, opts ArithmeticOptions, op func(a, b, max float64) float64) error {
+	if other.width != ppm.width || other.height != ppm.height {
+		return fmt.Errorf("image sizes differ: %dx%d and %dx%d", ppm.width, ppm.height, other.width, other.height)
+	}
+	ar, ag, ab := ppm.planes()
+	br, bg, bb := other.planes()
+	for _, plane := range [][][]float64{br, bg, bb} {
+		for y := range plane {
+			for x, v := range plane[y] {
+				plane[y][x] = float64(rescale(uint8(v), other.max, ppm.max))
+			}
+		}
+	}
+	out := arithmetic([][][]float64{ar, ag, ab}, [][][]float64{br, bg, bb}, ppm.width, ppm.height, ppm.max, opts, op)
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			ppm.data[y][x] = Pixel{R: out[0][y][x], G: out[1][y][x], B: out[2][y][x]}
+		}
+	}
+	return nil
+}
+
+func arithAdd(a, b, max float64) float64      { return a + b }
+func arithSubtract(a, b, max float64) float64 { return a - b }
+func arithAbsDiff(a, b, max float64) float64  { return math.Abs(a - b) }
+func arithMultiply(a, b, max float64) float64 { return a * b / max }
+func arithMin(a, b, max float64) float64      { return math.Min(a, b) }
+func arithMax(a, b, max float64) float64      { return math.Max(a, b) }
+
+// arithDivide returns a / b scaled to max; a division by zero gives max.
+func arithDivide(a, b, max float64) float64 {
+	if b == 0 {
+		return max
+	}
+	return a / b * max
+}
+
+// Add adds the gray levels of other to those of the PGM image. Both images
+// must have the same size; other is rescaled to the max value of the image.
+func (pgm *PGM) Add(other *PGM, opts ArithmeticOptions) error {
+	return pgm.combine(other, opts, arithAdd)
+}
+
+// Add adds the channels of other to those of the PPM image. See PGM.Add.
+func (ppm *PPM) Add(other *PPM, opts ArithmeticOptions) error {
+	return ppm.combine(other, opts, arithAdd)
+}
+
+// Subtract subtracts the gray levels of other from those of the PGM image.
+func (pgm *PGM) Subtract(other *PGM, opts ArithmeticOptions) error {
+	return pgm.combine(other, opts, arithSubtract)
+}
+
+// Subtract subtracts the channels of other from those of the PPM image.
+func (ppm *PPM) Subtract(other *PPM, opts ArithmeticOptions) error {
+	return ppm.combine(other, opts, arithSubtract)
+}
+
+// AbsDiff replaces the gray levels of the PGM image with their absolute
+// difference with those of other, which shows the changes between two images.
+func (pgm *PGM) AbsDiff(other *PGM, opts ArithmeticOptions) error {
+	return pgm.combine(other, opts, arithAbsDiff)
+}
+
+// AbsDiff replaces the channels of the PPM image with their absolute difference with those of other.
+func (ppm *PPM) AbsDiff(other *PPM, opts ArithmeticOptions) error {
+	return ppm.combine(other, opts, arithAbsDiff)
+}
+
+// Multiply multiplies the gray levels of the PGM image by those of other,
+// divided by the max value, as pamarith does: white leaves the image
+// unchanged and black makes it black.
+func (pgm *PGM) Multiply(other *PGM, opts ArithmeticOptions) error {
+	return pgm.combine(other, opts, arithMultiply)
+}
+
+// Multiply multiplies the channels of the PPM image by those of other. See PGM.Multiply.
+func (ppm *PPM) Multiply(other *PPM, opts ArithmeticOptions) error {
+	return ppm.combine(other, opts, arithMultiply)
+}
+
+// Divide divides the gray levels of the PGM image by those of other,
+// multiplied by the max value, as pamarith does. Divisions by zero give the
+// max value.
+func (pgm *PGM) Divide(other *PGM, opts ArithmeticOptions) error {
+	return pgm.combine(other, opts, arithDivide)
+}
+
+// Divide divides the channels of the PPM image by those of other. See PGM.Divide.
+func (ppm *PPM) Divide(other *PPM, opts ArithmeticOptions) error {
+	return ppm.combine(other, opts, arithDivide)
+}
+
+// Min keeps the darker of the gray levels of the PGM image and other.
+func (pgm *PGM) Min(other *PGM) error {
+	return pgm.combine(other, ArithmeticOptions{}, arithMin)
+}
+
+// Min keeps the lower of the levels of every channel of the PPM image and other.
+func (ppm *PPM) Min(other *PPM) error {
+	return ppm.combine(other, ArithmeticOptions{}, arithMin)
+}
+
+// Max keeps the lighter of the gray levels of the PGM image and other.
+func (pgm *PGM) Max(other *PGM) error {
+	return pgm.combine(other, ArithmeticOptions{}, arithMax)
+}
+
+// Max keeps the higher of the levels of every channel of the PPM image and other.
+func (ppm *PPM) Max(other *PPM) error {
+	return ppm.combine(other, ArithmeticOptions{}, arithMax)
+}
+
+// AddWeighted replaces the gray levels a of the PGM image with
+// alpha*a + beta*b + gamma, where b are the gray levels of other.
+func (pgm *PGM) AddWeighted(other *PGM, alpha, beta, gamma float64, opts ArithmeticOptions) error {
+	return pgm.combine(other, opts, func(a, b, max float64) float64 { return alpha*a + beta*b + gamma })
+}
+
+// AddWeighted blends every channel of the PPM image with other. See PGM.AddWeighted.
+func (ppm *PPM) AddWeighted(other *PPM, alpha, beta, gamma float64, opts ArithmeticOptions) error {
+	return ppm.combine(other, opts, func(a, b, max float64) float64 { return alpha*a + beta*b + gamma })
+}
@@ -0,0 +1,707 @@
+package Netpbm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BarcodeOptions controls how a barcode is rendered into a PBM image.
+type BarcodeOptions struct {
+	// ModuleSize is the width in pixels of the narrowest bar or of a QR
+	// module. It defaults to 1.
+	ModuleSize int
+	// QuietZone is the number of blank modules around the symbol. It
+	// defaults to the minimum scanners expect: 10 for Code 128, 11 for EAN-13
+	// and 4 for QR codes.
+	QuietZone int
+	// NoQuietZone renders the symbol without a quiet zone, for callers that
+	// place it on a blank area themselves. It overrides QuietZone.
+	NoQuietZone bool
+	// Height is the height in pixels of the bars of linear barcodes. It
+	// defaults to 50 modules.
+	Height int
+}
+
+// QRErrorCorrection is the error correction level of a QR code.
+type QRErrorCorrection int
+
+const (
+	// QRLevelL recovers about 7% of the codewords.
+	QRLevelL QRErrorCorrection = iota
+	// QRLevelM recovers about 15% of the codewords.
+	QRLevelM
+	// QRLevelQ recovers about 25% of the codewords.
+	QRLevelQ
+	// QRLevelH recovers about 30% of the codewords.
+	QRLevelH
+)
+
+// defaults fills in the unset options; quietZone is the minimum quiet zone of the symbology.
+func (opts BarcodeOptions) defaults(quietZone int) (BarcodeOptions, error) {
+	if opts.ModuleSize < 0 || opts.QuietZone < 0 || opts.Height < 0 {
+		return opts, fmt.Errorf("invalid barcode options: %+v", opts)
+	}
+	if opts.ModuleSize == 0 {
+		opts.ModuleSize = 1
+	}
+	if opts.Height == 0 {
+		opts.Height = 50 * opts.ModuleSize
+	}
+	if opts.NoQuietZone {
+		opts.QuietZone = 0
+	} else if opts.QuietZone == 0 {
+		opts.QuietZone = quietZone
+	}
+	return opts, nil
+}
+
+// renderLinear draws a row of bars, given as '1' (black) and '0' (white) modules.
+func renderLinear(modules string, opts BarcodeOptions) *PBM {
+	width := (len(modules) + 2*opts.QuietZone) * opts.ModuleSize
+	pbm := newPBM(width, opts.Height, "P1")
+	for i, m := range modules {
+		if m != '1' {
+			continue
+		}
+		x0 := (opts.QuietZone + i) * opts.ModuleSize
+		for y := 0; y < opts.Height; y++ {
+			for x := x0; x < x0+opts.ModuleSize; x++ {
+				// Set takes the row first
+				pbm.Set(y, x, true)
+			}
+		}
+	}
+	return pbm
+}
+
+// code128Patterns holds the bar and space widths of the Code 128 symbols 0 to 106.
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code 128 special symbols
+const (
+	code128Shift  = 98
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// digitRun returns the number of consecutive digits of s starting at i.
+func digitRun(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// code128Symbols encodes ASCII text into Code 128 symbol values, using code
+// set C for runs of digits and code set B, with shifts to A for control
+// characters, for the rest.
+func code128Symbols(data string) ([]int, error) {
+	var symbols []int
+	inC := digitRun(data, 0) >= 4
+	if inC {
+		symbols = append(symbols, code128StartC)
+	} else {
+		symbols = append(symbols, code128StartB)
+	}
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		if c > 127 {
+			return nil, fmt.Errorf("character %q cannot be encoded in Code 128", c)
+		}
+		run := digitRun(data, i)
+		if inC {
+			if run >= 2 {
+				symbols = append(symbols, int(data[i]-'0')*10+int(data[i+1]-'0'))
+				i += 2
+				continue
+			}
+			symbols = append(symbols, code128CodeB)
+			inC = false
+		}
+		// Switch to code set C for long runs of digits
+		if run >= 6 || (run >= 4 && i+run == len(data)) {
+			if run%2 == 1 {
+				symbols = append(symbols, int(c)-32)
+				i++
+			}
+			symbols = append(symbols, code128CodeC)
+			inC = true
+			continue
+		}
+		if c < 32 {
+			symbols = append(symbols, code128Shift, int(c)+64)
+		} else {
+			symbols = append(symbols, int(c)-32)
+		}
+		i++
+	}
+
+	// Checksum: start value plus each symbol weighted by its position
+	sum := symbols[0]
+	for i, s := range symbols[1:] {
+		sum += (i + 1) * s
+	}
+	return append(symbols, sum%103, code128Stop), nil
+}
+
+// Code128 renders ASCII text as a Code 128 barcode.
+func Code128(data string, opts BarcodeOptions) (*PBM, error) {
+	opts, err := opts.defaults(10)
+	if err != nil {
+		return nil, err
+	}
+	symbols, err := code128Symbols(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand the widths into modules, alternating bars and spaces
+	var modules strings.Builder
+	for _, s := range symbols {
+		for i, w := range code128Patterns[s] {
+			bit := "1"
+			if i%2 == 1 {
+				bit = "0"
+			}
+			modules.WriteString(strings.Repeat(bit, int(w-'0')))
+		}
+	}
+	return renderLinear(modules.String(), opts), nil
+}
+
+// EAN-13 digit encodings: L and G on the left half, R on the right half
+var (
+	eanL = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	eanG = [10]string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	eanR = [10]string{"1110010", "1100110", "1101100", "1000010", "1011100", "1001110", "1010000", "1000100", "1001000", "1110100"}
+	// eanParity selects L or G for the left digits from the first digit
+	eanParity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// EAN13 renders an EAN-13 barcode. digits holds 12 digits, to which the check
+// digit is appended, or 13 digits whose check digit is verified.
+func EAN13(digits string, opts BarcodeOptions) (*PBM, error) {
+	opts, err := opts.defaults(11)
+	if err != nil {
+		return nil, err
+	}
+	if (len(digits) != 12 && len(digits) != 13) || digitRun(digits, 0) != len(digits) {
+		return nil, fmt.Errorf("EAN-13 needs 12 or 13 digits, got %q", digits)
+	}
+
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	check := byte('0' + (10-sum%10)%10)
+	if len(digits) == 13 && digits[12] != check {
+		return nil, fmt.Errorf("invalid EAN-13 check digit %c, expected %c", digits[12], check)
+	}
+	digits = digits[:12] + string(check)
+
+	var modules strings.Builder
+	modules.WriteString("101")
+	parity := eanParity[digits[0]-'0']
+	for i := 1; i <= 6; i++ {
+		if parity[i-1] == 'L' {
+			modules.WriteString(eanL[digits[i]-'0'])
+		} else {
+			modules.WriteString(eanG[digits[i]-'0'])
+		}
+	}
+	modules.WriteString("01010")
+	for i := 7; i <= 12; i++ {
+		modules.WriteString(eanR[digits[i]-'0'])
+	}
+	modules.WriteString("101")
+	return renderLinear(modules.String(), opts), nil
+}
+
+// Error correction codewords per block, indexed by level and version
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// Number of error correction blocks, indexed by level and version
+var qrBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// qrFormatLevel holds the format information bits of each error correction level
+var qrFormatLevel = [4]int{1, 0, 3, 2}
+
+// qrRawModules returns the number of modules available for data and error
+// correction in a QR code of the given version.
+func qrRawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// qrDataCodewords returns the number of data codewords of a QR code.
+func qrDataCodewords(version int, level QRErrorCorrection) int {
+	return qrRawModules(version)/8 - qrECCPerBlock[level][version]*qrBlocks[level][version]
+}
+
+// qrAlignmentPositions returns the coordinates of the alignment pattern centers.
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// gfMultiply multiplies two elements of GF(2^8) with the QR code polynomial 0x11D.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree,
+// without its leading coefficient.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	var root byte = 1
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords of data.
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// qrCode is a QR code symbol under construction.
+type qrCode struct {
+	size       int
+	version    int
+	level      QRErrorCorrection
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// setFunction sets a module belonging to a function pattern.
+func (q *qrCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// reserves the format and version areas.
+func (q *qrCode) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, c := range [3][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || y < 0 || x >= q.size || y >= q.size {
+					continue
+				}
+				dist := absInt(dx)
+				if absInt(dy) > dist {
+					dist = absInt(dy)
+				}
+				q.setFunction(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	positions := qrAlignmentPositions(q.version)
+	last := len(positions) - 1
+	for i, cy := range positions {
+		for j, cx := range positions {
+			// Skip the corners occupied by the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					dist := absInt(dx)
+					if absInt(dy) > dist {
+						dist = absInt(dy)
+					}
+					q.setFunction(cx+dx, cy+dy, dist != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+// drawFormatBits draws the error correction level and mask in both format areas.
+func (q *qrCode) drawFormatBits(mask int) {
+	data := qrFormatLevel[q.level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	// Copy around the top-left finder
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+
+	// Copy split between the two other finders
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true)
+}
+
+// drawVersion draws the version information of versions 7 and up.
+func (q *qrCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := q.size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// interleave splits the data codewords into blocks, appends their error
+// correction codewords and interleaves the blocks.
+func (q *qrCode) interleave(data []byte) []byte {
+	numBlocks := qrBlocks[q.level][q.version]
+	eccLen := qrECCPerBlock[q.level][q.version]
+	raw := qrRawModules(q.version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShort {
+			// Placeholder keeping all blocks the same length, skipped below
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	var result []byte
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.isFunction[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the mask pattern; applying
+// the same mask twice restores the symbol.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.isFunction[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to scan; the mask giving the lowest
+// score is used.
+func (q *qrCode) penalty() int {
+	score := 0
+	at := func(x, y int, horizontal bool) bool {
+		if horizontal {
+			return q.modules[y][x]
+		}
+		return q.modules[x][y]
+	}
+
+	for _, horizontal := range []bool{true, false} {
+		for a := 0; a < q.size; a++ {
+			// Runs of five or more modules of the same color
+			run := 1
+			for b := 1; b < q.size; b++ {
+				if at(b, a, horizontal) == at(b-1, a, horizontal) {
+					run++
+					if run == 5 {
+						score += 3
+					} else if run > 5 {
+						score++
+					}
+				} else {
+					run = 1
+				}
+			}
+
+			// Finder-like patterns 1:1:3:1:1 with four light modules on one side
+			for b := 0; b+11 <= q.size; b++ {
+				var pattern strings.Builder
+				for k := b; k < b+11; k++ {
+					if at(k, a, horizontal) {
+						pattern.WriteByte('1')
+					} else {
+						pattern.WriteByte('0')
+					}
+				}
+				if p := pattern.String(); p == "10111010000" || p == "00001011101" {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := q.modules[y][x]
+				if c == q.modules[y][x-1] && c == q.modules[y-1][x] && c == q.modules[y-1][x-1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	total := q.size * q.size
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	score += k * 10
+	return score
+}
+
+// QRCode renders data as a QR code in byte mode, using the smallest version
+// that fits the data at the given error correction level.
+func QRCode(data string, level QRErrorCorrection, opts BarcodeOptions) (*PBM, error) {
+	opts, err := opts.defaults(4)
+	if err != nil {
+		return nil, err
+	}
+	if level < QRLevelL || level > QRLevelH {
+		return nil, fmt.Errorf("invalid error correction level: %d", level)
+	}
+
+	// Find the smallest version that fits the data
+	version := 0
+	for v := 1; v <= 40; v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= qrDataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("data too long for a QR code: %d bytes", len(data))
+	}
+
+	// Build the bit stream: mode, character count, data, terminator and padding
+	capacity := qrDataCodewords(version, level) * 8
+	w := &bitWriter{}
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			if (v>>uint(i))&1 != 0 {
+				w.writeCode("1")
+			} else {
+				w.writeCode("0")
+			}
+		}
+	}
+	appendBits(0x4, 4)
+	if version >= 10 {
+		appendBits(len(data), 16)
+	} else {
+		appendBits(len(data), 8)
+	}
+	for i := 0; i < len(data); i++ {
+		appendBits(int(data[i]), 8)
+	}
+	terminator := capacity - w.nbits
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	appendBits(0, (8-w.nbits%8)%8)
+	for pad := 0xEC; w.nbits < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	q := &qrCode{size: version*4 + 17, version: version, level: level}
+	q.modules = make([][]bool, q.size)
+	q.isFunction = make([][]bool, q.size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.size)
+		q.isFunction[i] = make([]bool, q.size)
+	}
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.interleave(w.data))
+
+	// Keep the mask with the lowest penalty
+	best, bestScore := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if score := q.penalty(); bestScore < 0 || score < bestScore {
+			best, bestScore = mask, score
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+
+	// Render the modules with the quiet zone
+	side := (q.size + 2*opts.QuietZone) * opts.ModuleSize
+	pbm := newPBM(side, side, "P1")
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			x0, y0 := (opts.QuietZone+x)*opts.ModuleSize, (opts.QuietZone+y)*opts.ModuleSize
+			for j := y0; j < y0+opts.ModuleSize; j++ {
+				for i := x0; i < x0+opts.ModuleSize; i++ {
+					// Set takes the row first
+					pbm.Set(j, i, true)
+				}
+			}
+		}
+	}
+	return pbm, nil
+}
@@ -0,0 +1,133 @@
+package Netpbm
+
+// bitmap is a PBM raster packed 64 pixels per word: pixel x of a row is bit
+// x%64 of word x/64. Bits past the width of the image are always zero.
+type bitmap struct {
+	words         [][]uint64
+	width, height int
+	stride        int
+}
+
+// newBitmap returns a blank bitmap of the given size.
+func newBitmap(width, height int) *bitmap {
+	stride := (width + 63) / 64
+	words := make([][]uint64, height)
+	for y := range words {
+		words[y] = make([]uint64, stride)
+	}
+	return &bitmap{words: words, width: width, height: height, stride: stride}
+}
+
+// packPBM packs the pixels of a PBM image into a bitmap.
+func packPBM(pbm *PBM) *bitmap {
+	b := newBitmap(pbm.width, pbm.height)
+	for y := 0; y < pbm.height; y++ {
+		row := b.words[y]
+		for x, v := range pbm.data[y] {
+			if v {
+				row[x>>6] |= 1 << uint(x&63)
+			}
+		}
+	}
+	return b
+}
+
+// unpack writes the bitmap back into PBM pixel data of the same size.
+func (b *bitmap) unpack(data [][]bool) {
+	for y := 0; y < b.height; y++ {
+		row := b.words[y]
+		for x := 0; x < b.width; x++ {
+			data[y][x] = row[x>>6]&(1<<uint(x&63)) != 0
+		}
+	}
+}
+
+// lastMask returns the mask of the valid bits of the last word of a row.
+func (b *bitmap) lastMask() uint64 {
+	if b.width%64 == 0 {
+		return ^uint64(0)
+	}
+	return 1<<uint(b.width%64) - 1
+}
+
+// fillRow sets a row to all ones or all zeros.
+func (b *bitmap) fillRow(row []uint64, value bool) {
+	for i := range row {
+		if value {
+			row[i] = ^uint64(0)
+		} else {
+			row[i] = 0
+		}
+	}
+	if len(row) > 0 {
+		row[len(row)-1] &= b.lastMask()
+	}
+}
+
+// shiftRow stores in dst the row src moved dx pixels to the right, so that
+// dst[x] = src[x-dx]. Pixels shifted in from outside the row are set to fill.
+func (b *bitmap) shiftRow(dst, src []uint64, dx int, fill bool) {
+	n := len(src)
+	if dx >= 0 {
+		q, r := dx>>6, uint(dx&63)
+		for i := n - 1; i >= 0; i-- {
+			var v uint64
+			if j := i - q; j >= 0 {
+				v = src[j] << r
+				if r > 0 && j > 0 {
+					v |= src[j-1] >> (64 - r)
+				}
+			}
+			dst[i] = v
+		}
+		if fill {
+			setBits(dst, 0, clampInt(dx, 0, b.width))
+		}
+	} else {
+		q, r := (-dx)>>6, uint((-dx)&63)
+		for i := 0; i < n; i++ {
+			var v uint64
+			if j := i + q; j < n {
+				v = src[j] >> r
+				if r > 0 && j+1 < n {
+					v |= src[j+1] << (64 - r)
+				}
+			}
+			dst[i] = v
+		}
+		if fill {
+			setBits(dst, clampInt(b.width+dx, 0, b.width), b.width)
+		}
+	}
+	if n > 0 {
+		dst[n-1] &= b.lastMask()
+	}
+}
+
+// setBits sets the bits [from, to) of a row.
+func setBits(row []uint64, from, to int) {
+	for x := from; x < to; {
+		if x&63 == 0 && to-x >= 64 {
+			row[x>>6] = ^uint64(0)
+			x += 64
+			continue
+		}
+		row[x>>6] |= 1 << uint(x&63)
+		x++
+	}
+}
+
+// not returns the complement of the bitmap.
+func (b *bitmap) not() *bitmap {
+	result := newBitmap(b.width, b.height)
+	mask := b.lastMask()
+	for y := 0; y < b.height; y++ {
+		for i, w := range b.words[y] {
+			result.words[y][i] = ^w
+		}
+		if b.stride > 0 {
+			result.words[y][b.stride-1] &= mask
+		}
+	}
+	return result
+}
@@ -0,0 +1,279 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// recursiveSigma is the standard deviation from which Gaussian blurs switch
+// from convolution to the recursive filter, whose cost does not depend on sigma.
+const recursiveSigma = 3.0
+
+// gaussianBlurPlane blurs a plane of values with a Gaussian of standard deviation sigma.
+func gaussianBlurPlane(plane [][]float64, width, height int, sigma float64) [][]float64 {
+	if sigma < recursiveSigma {
+		kernel := gaussianKernel(sigma, int(math.Ceil(3*sigma)))
+		return convolveSeparable(plane, width, height, kernel, kernel, BorderReflect, 0)
+	}
+
+	out := make([][]float64, height)
+	for y := range out {
+		out[y] = append([]float64(nil), plane[y]...)
+		recursiveGaussian(out[y], sigma)
+	}
+	column := make([]float64, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			column[y] = out[y][x]
+		}
+		recursiveGaussian(column, sigma)
+		for y := 0; y < height; y++ {
+			out[y][x] = column[y]
+		}
+	}
+	return out
+}
+
+// recursiveGaussian blurs a line in place with the recursive Gaussian filter
+// of Young and van Vliet, run forward then backward. The line is extended by
+// its edge values.
+func recursiveGaussian(line []float64, sigma float64) {
+	if len(line) == 0 {
+		return
+	}
+	var q float64
+	if sigma >= 2.5 {
+		q = 0.98711*sigma - 0.96330
+	} else {
+		q = 3.97156 - 4.14554*math.Sqrt(1-0.26891*sigma)
+	}
+	b0 := 1.57825 + 2.44413*q + 1.4281*q*q + 0.422205*q*q*q
+	b1 := (2.44413*q + 2.85619*q*q + 1.26661*q*q*q) / b0
+	b2 := -(1.4281*q*q + 1.26661*q*q*q) / b0
+	b3 := 0.422205 * q * q * q / b0
+	B := 1 - (b1 + b2 + b3)
+
+	// Both passes start from the steady state of a constant edge
+	w1, w2, w3 := line[0], line[0], line[0]
+	for i, v := range line {
+		w := B*v + b1*w1 + b2*w2 + b3*w3
+		line[i] = w
+		w1, w2, w3 = w, w1, w2
+	}
+	last := line[len(line)-1]
+	w1, w2, w3 = last, last, last
+	for i := len(line) - 1; i >= 0; i-- {
+		w := B*line[i] + b1*w1 + b2*w2 + b3*w3
+		line[i] = w
+		w1, w2, w3 = w, w1, w2
+	}
+}
+
+// boxBlurPlane averages a plane of values over windows of (2*radius+1)²
+// pixels with running sums, repeating the edge pixels.
+func boxBlurPlane(plane [][]float64, width, height, radius int) [][]float64 {
+	size := float64(2*radius + 1)
+	rows := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		rows[y] = make([]float64, width)
+		sum := 0.0
+		for i := -radius; i <= radius; i++ {
+			sum += plane[y][clampInt(i, 0, width-1)]
+		}
+		for x := 0; x < width; x++ {
+			rows[y][x] = sum / size
+			sum += plane[y][clampInt(x+radius+1, 0, width-1)] - plane[y][clampInt(x-radius, 0, width-1)]
+		}
+	}
+
+	out := make([][]float64, height)
+	for y := range out {
+		out[y] = make([]float64, width)
+	}
+	for x := 0; x < width; x++ {
+		sum := 0.0
+		for i := -radius; i <= radius; i++ {
+			sum += rows[clampInt(i, 0, height-1)][x]
+		}
+		for y := 0; y < height; y++ {
+			out[y][x] = sum / size
+			sum += rows[clampInt(y+radius+1, 0, height-1)][x] - rows[clampInt(y-radius, 0, height-1)][x]
+		}
+	}
+	return out
+}
+
+// unsharpPlane adds amount times the difference between a plane and its blur
+// to the plane, where the difference is at least threshold.
+func unsharpPlane(plane, blurred [][]float64, amount, threshold float64) [][]float64 {
+	out := make([][]float64, len(plane))
+	for y := range plane {
+		out[y] = make([]float64, len(plane[y]))
+		for x, v := range plane[y] {
+			out[y][x] = v
+			if diff := v - blurred[y][x]; math.Abs(diff) >= threshold {
+				out[y][x] += amount * diff
+			}
+		}
+	}
+	return out
+}
+
+// bilateral averages every pixel with the pixels of its neighborhood weighted
+// by their distance in space and in value. The value distance is computed
+// over all the planes together, so that the planes of a color image are
+// smoothed with the same weights.
+func bilateral(planes [][][]float64, width, height int, sigmaSpatial, sigmaRange float64) [][][]float64 {
+	radius := int(math.Ceil(2 * sigmaSpatial))
+	spatial := make([][]float64, 2*radius+1)
+	for j := range spatial {
+		spatial[j] = make([]float64, 2*radius+1)
+		for i := range spatial[j] {
+			dx, dy := float64(i-radius), float64(j-radius)
+			spatial[j][i] = math.Exp(-(dx*dx + dy*dy) / (2 * sigmaSpatial * sigmaSpatial))
+		}
+	}
+
+	out := make([][][]float64, len(planes))
+	for c := range out {
+		out[c] = make([][]float64, height)
+		for y := range out[c] {
+			out[c][y] = make([]float64, width)
+		}
+	}
+	sums := make([]float64, len(planes))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			for c := range sums {
+				sums[c] = 0
+			}
+			total := 0.0
+			for j := -radius; j <= radius; j++ {
+				sy := y + j
+				if sy < 0 || sy >= height {
+					continue
+				}
+				for i := -radius; i <= radius; i++ {
+					sx := x + i
+					if sx < 0 || sx >= width {
+						continue
+					}
+					distance := 0.0
+					for _, plane := range planes {
+						d := plane[sy][sx] - plane[y][x]
+						distance += d * d
+					}
+					w := spatial[j+radius][i+radius] * math.Exp(-distance/(2*sigmaRange*sigmaRange))
+					for c, plane := range planes {
+						sums[c] += w * plane[sy][sx]
+					}
+					total += w
+				}
+			}
+			for c := range out {
+				out[c][y][x] = sums[c] / total
+			}
+		}
+	}
+	return out
+}
+
+// GaussianBlur blurs the PGM image with a Gaussian of standard deviation
+// sigma. Large values of sigma use a recursive filter, as fast as small ones.
+func (pgm *PGM) GaussianBlur(sigma float64) error {
+	if sigma <= 0 {
+		return fmt.Errorf("invalid sigma: %g", sigma)
+	}
+	pgm.setPlane(gaussianBlurPlane(pgm.plane(), pgm.width, pgm.height, sigma), 0)
+	return nil
+}
+
+// GaussianBlur blurs every channel of the PPM image. See PGM.GaussianBlur.
+func (ppm *PPM) GaussianBlur(sigma float64) error {
+	if sigma <= 0 {
+		return fmt.Errorf("invalid sigma: %g", sigma)
+	}
+	r, g, b := ppm.planes()
+	ppm.setPlanes(
+		gaussianBlurPlane(r, ppm.width, ppm.height, sigma),
+		gaussianBlurPlane(g, ppm.width, ppm.height, sigma),
+		gaussianBlurPlane(b, ppm.width, ppm.height, sigma),
+		0)
+	return nil
+}
+
+// BoxBlur replaces every pixel of the PGM image with the average of the
+// square of side 2*radius+1 around it. Its cost does not depend on radius.
+func (pgm *PGM) BoxBlur(radius int) error {
+	if radius < 0 {
+		return fmt.Errorf("invalid radius: %d", radius)
+	}
+	pgm.setPlane(boxBlurPlane(pgm.plane(), pgm.width, pgm.height, radius), 0)
+	return nil
+}
+
+// BoxBlur blurs every channel of the PPM image. See PGM.BoxBlur.
+func (ppm *PPM) BoxBlur(radius int) error {
+	if radius < 0 {
+		return fmt.Errorf("invalid radius: %d", radius)
+	}
+	r, g, b := ppm.planes()
+	ppm.setPlanes(
+		boxBlurPlane(r, ppm.width, ppm.height, radius),
+		boxBlurPlane(g, ppm.width, ppm.height, radius),
+		boxBlurPlane(b, ppm.width, ppm.height, radius),
+		0)
+	return nil
+}
+
+// UnsharpMask sharpens the PGM image by adding amount times its difference
+// with a Gaussian blur of standard deviation radius. Pixels differing from
+// the blur by less than threshold gray levels are left unchanged, so that
+// noise in flat areas is not amplified.
+func (pgm *PGM) UnsharpMask(amount, radius, threshold float64) error {
+	if radius <= 0 {
+		return fmt.Errorf("invalid radius: %g", radius)
+	}
+	plane := pgm.plane()
+	pgm.setPlane(unsharpPlane(plane, gaussianBlurPlane(plane, pgm.width, pgm.height, radius), amount, threshold), 0)
+	return nil
+}
+
+// UnsharpMask sharpens every channel of the PPM image. See PGM.UnsharpMask.
+func (ppm *PPM) UnsharpMask(amount, radius, threshold float64) error {
+	if radius <= 0 {
+		return fmt.Errorf("invalid radius: %g", radius)
+	}
+	r, g, b := ppm.planes()
+	sharpen := func(plane [][]float64) [][]float64 {
+		return unsharpPlane(plane, gaussianBlurPlane(plane, ppm.width, ppm.height, radius), amount, threshold)
+	}
+	ppm.setPlanes(sharpen(r), sharpen(g), sharpen(b), 0)
+	return nil
+}
+
+// Bilateral smooths the PGM image while preserving its edges: every pixel is
+// averaged with its neighbors weighted by a Gaussian of their distance, of
+// standard deviation sigmaSpatial pixels, and by a Gaussian of their
+// difference in gray level, of standard deviation sigmaRange.
+func (pgm *PGM) Bilateral(sigmaSpatial, sigmaRange float64) error {
+	if sigmaSpatial <= 0 || sigmaRange <= 0 {
+		return fmt.Errorf("invalid sigmas: %g, %g", sigmaSpatial, sigmaRange)
+	}
+	out := bilateral([][][]float64{pgm.plane()}, pgm.width, pgm.height, sigmaSpatial, sigmaRange)
+	pgm.setPlane(out[0], 0)
+	return nil
+}
+
+// Bilateral smooths the PPM image while preserving its edges. The difference
+// between two pixels is their Euclidean distance in RGB, so that all channels
+// are smoothed alike and no color fringes appear. See PGM.Bilateral.
+func (ppm *PPM) Bilateral(sigmaSpatial, sigmaRange float64) error {
+	if sigmaSpatial <= 0 || sigmaRange <= 0 {
+		return fmt.Errorf("invalid sigmas: %g, %g", sigmaSpatial, sigmaRange)
+	}
+	r, g, b := ppm.planes()
+	out := bilateral([][][]float64{r, g, b}, ppm.width, ppm.height, sigmaSpatial, sigmaRange)
+	ppm.setPlanes(out[0], out[1], out[2], 0)
+	return nil
+}
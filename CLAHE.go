@@ -0,0 +1,149 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// luminance returns the Rec. 601 luma of the PPM image as a PGM image with the same max value.
+func (ppm *PPM) luminance() *PGM {
+	pgm := newPGM(ppm.width, ppm.height, ppm.max, "P2")
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			p := ppm.data[y][x]
+			pgm.data[y][x] = clampUint8(0.299*float64(p.R)+0.587*float64(p.G)+0.114*float64(p.B), ppm.max)
+		}
+	}
+	return pgm
+}
+
+// clipHistogram limits every bin to limit and spreads the excess evenly over all bins.
+func clipHistogram(counts []int, limit int) {
+	excess := 0
+	for i, n := range counts {
+		if n > limit {
+			excess += n - limit
+			counts[i] = limit
+		}
+	}
+	share, rest := excess/len(counts), excess%len(counts)
+	for i := range counts {
+		counts[i] += share
+	}
+	if rest > 0 {
+		step := len(counts) / rest
+		for i := 0; i < len(counts) && rest > 0; i += step {
+			counts[i]++
+			rest--
+		}
+	}
+}
+
+// CLAHE applies contrast-limited adaptive histogram equalization to the PGM
+// image. The image is divided into a tilesX x tilesY grid, each tile is
+// equalized with its own histogram clipped at clipLimit times the average bin
+// count (0 disables clipping), and the mappings of neighboring tiles are
+// blended bilinearly to avoid seams.
+func (pgm *PGM) CLAHE(tilesX, tilesY int, clipLimit float64) error {
+	if tilesX < 1 || tilesY < 1 {
+		return fmt.Errorf("invalid tile grid: %d x %d", tilesX, tilesY)
+	}
+	if clipLimit < 0 {
+		return fmt.Errorf("invalid clip limit: %g", clipLimit)
+	}
+	if tilesX > pgm.width {
+		tilesX = pgm.width
+	}
+	if tilesY > pgm.height {
+		tilesY = pgm.height
+	}
+	if tilesX == 0 || tilesY == 0 {
+		return nil
+	}
+
+	// Tile i covers [bound(i), bound(i+1)) along each axis
+	boundX := func(i int) int { return i * pgm.width / tilesX }
+	boundY := func(j int) int { return j * pgm.height / tilesY }
+
+	// Build the clipped equalization table of every tile
+	bins := int(pgm.max) + 1
+	luts := make([][][]float64, tilesY)
+	for j := 0; j < tilesY; j++ {
+		luts[j] = make([][]float64, tilesX)
+		for i := 0; i < tilesX; i++ {
+			counts := make([]int, bins)
+			for y := boundY(j); y < boundY(j+1); y++ {
+				for x := boundX(i); x < boundX(i+1); x++ {
+					counts[clampInt(int(pgm.data[y][x]), 0, bins-1)]++
+				}
+			}
+			area := (boundY(j+1) - boundY(j)) * (boundX(i+1) - boundX(i))
+			if clipLimit > 0 {
+				limit := int(clipLimit * float64(area) / float64(bins))
+				if limit < 1 {
+					limit = 1
+				}
+				clipHistogram(counts, limit)
+			}
+
+			lut := make([]float64, bins)
+			sum := 0
+			for v, n := range counts {
+				sum += n
+				lut[v] = float64(sum) * float64(pgm.max) / float64(area)
+			}
+			luts[j][i] = lut
+		}
+	}
+
+	// Blend the tables of the four nearest tile centers
+	neighbor := func(pos float64, tiles int) (int, int, float64) {
+		t0 := int(math.Floor(pos))
+		a := pos - float64(t0)
+		if t0 < 0 {
+			return 0, 0, 0
+		}
+		if t0 >= tiles-1 {
+			return tiles - 1, tiles - 1, 0
+		}
+		return t0, t0 + 1, a
+	}
+	for y := 0; y < pgm.height; y++ {
+		ty0, ty1, ay := neighbor((float64(y)+0.5)*float64(tilesY)/float64(pgm.height)-0.5, tilesY)
+		for x := 0; x < pgm.width; x++ {
+			tx0, tx1, ax := neighbor((float64(x)+0.5)*float64(tilesX)/float64(pgm.width)-0.5, tilesX)
+			v := clampInt(int(pgm.data[y][x]), 0, bins-1)
+			top := (1-ax)*luts[ty0][tx0][v] + ax*luts[ty0][tx1][v]
+			bottom := (1-ax)*luts[ty1][tx0][v] + ax*luts[ty1][tx1][v]
+			pgm.data[y][x] = clampUint8((1-ay)*top+ay*bottom, pgm.max)
+		}
+	}
+	return nil
+}
+
+// CLAHE applies contrast-limited adaptive histogram equalization to the
+// luminance of the PPM image, keeping the chroma of every pixel. See
+// PGM.CLAHE for the parameters.
+func (ppm *PPM) CLAHE(tilesX, tilesY int, clipLimit float64) error {
+	luma := ppm.luminance()
+	equalized := newPGM(luma.width, luma.height, luma.max, luma.magicNumber)
+	for y := range luma.data {
+		copy(equalized.data[y], luma.data[y])
+	}
+	if err := equalized.CLAHE(tilesX, tilesY, clipLimit); err != nil {
+		return err
+	}
+
+	// Shift every channel by the change of luminance
+	shift := func(v uint8, delta float64) uint8 {
+		return clampUint8(float64(v)+delta, ppm.max)
+	}
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			delta := float64(equalized.data[y][x]) - float64(luma.data[y][x])
+			p := ppm.data[y][x]
+			ppm.data[y][x] = Pixel{R: shift(p.R, delta), G: shift(p.G, delta), B: shift(p.B, delta)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package Netpbm
+
+// Connectivity selects which neighbors of a pixel are considered adjacent.
+type Connectivity int
+
+const (
+	// Connectivity4 joins pixels sharing an edge.
+	Connectivity4 Connectivity = 4
+	// Connectivity8 joins pixels sharing an edge or a corner.
+	Connectivity8 Connectivity = 8
+)
+
+// Component describes a connected region of black pixels.
+type Component struct {
+	// Label is the value of the component's pixels in the label map.
+	Label int
+	// Area is the number of pixels of the component.
+	Area int
+	// Bounds is the smallest rectangle containing the component.
+	Bounds Rectangle
+	// CentroidX and CentroidY are the mean coordinates of the component's pixels.
+	CentroidX, CentroidY float64
+	// Perimeter is the number of pixel edges between the component and the
+	// white pixels or the border of the image.
+	Perimeter int
+}
+
+// find returns the root of label l, compressing the path on the way.
+func find(parent []int, l int) int {
+	for parent[l] != l {
+		parent[l] = parent[parent[l]]
+		l = parent[l]
+	}
+	return l
+}
+
+// union merges the sets of labels a and b, keeping the smaller root.
+func union(parent []int, a, b int) {
+	ra, rb := find(parent, a), find(parent, b)
+	if ra < rb {
+		parent[rb] = ra
+	} else if rb < ra {
+		parent[ra] = rb
+	}
+}
+
+// ConnectedComponents labels the connected regions of black pixels of the PBM
+// image. The label map holds 0 for white pixels and the component's label,
+// starting at 1 in raster order, for black pixels. The component at index i of
+// the returned slice has label i+1.
+func (pbm *PBM) ConnectedComponents(conn Connectivity) ([][]int, []Component) {
+	labels := make([][]int, pbm.height)
+	for y := range labels {
+		labels[y] = make([]int, pbm.width)
+	}
+
+	// First pass: provisional labels and their equivalences
+	parent := []int{0}
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if !pbm.data[y][x] {
+				continue
+			}
+			var neighbors [4]int
+			n := 0
+			if x > 0 && labels[y][x-1] != 0 {
+				neighbors[n] = labels[y][x-1]
+				n++
+			}
+			if y > 0 {
+				if labels[y-1][x] != 0 {
+					neighbors[n] = labels[y-1][x]
+					n++
+				}
+				if conn == Connectivity8 {
+					if x > 0 && labels[y-1][x-1] != 0 {
+						neighbors[n] = labels[y-1][x-1]
+						n++
+					}
+					if x+1 < pbm.width && labels[y-1][x+1] != 0 {
+						neighbors[n] = labels[y-1][x+1]
+						n++
+					}
+				}
+			}
+			if n == 0 {
+				parent = append(parent, len(parent))
+				labels[y][x] = len(parent) - 1
+				continue
+			}
+			labels[y][x] = neighbors[0]
+			for i := 1; i < n; i++ {
+				union(parent, neighbors[0], neighbors[i])
+			}
+		}
+	}
+
+	// Second pass: final labels in raster order and statistics
+	final := make([]int, len(parent))
+	var components []Component
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if labels[y][x] == 0 {
+				continue
+			}
+			root := find(parent, labels[y][x])
+			if final[root] == 0 {
+				components = append(components, Component{
+					Label:  len(components) + 1,
+					Bounds: Rectangle{Min: Point{X: x, Y: y}, Max: Point{X: x + 1, Y: y + 1}},
+				})
+				final[root] = len(components)
+			}
+			label := final[root]
+			labels[y][x] = label
+
+			c := &components[label-1]
+			c.Area++
+			c.CentroidX += float64(x)
+			c.CentroidY += float64(y)
+			if x < c.Bounds.Min.X {
+				c.Bounds.Min.X = x
+			}
+			if x+1 > c.Bounds.Max.X {
+				c.Bounds.Max.X = x + 1
+			}
+			c.Bounds.Max.Y = y + 1
+			if x == 0 || !pbm.data[y][x-1] {
+				c.Perimeter++
+			}
+			if x == pbm.width-1 || !pbm.data[y][x+1] {
+				c.Perimeter++
+			}
+			if y == 0 || !pbm.data[y-1][x] {
+				c.Perimeter++
+			}
+			if y == pbm.height-1 || !pbm.data[y+1][x] {
+				c.Perimeter++
+			}
+		}
+	}
+	for i := range components {
+		components[i].CentroidX /= float64(components[i].Area)
+		components[i].CentroidY /= float64(components[i].Area)
+	}
+
+	return labels, components
+}
+
+// FilterComponents turns white every component of the PBM image for which
+// keep returns false and returns the number of components removed.
+func (pbm *PBM) FilterComponents(conn Connectivity, keep func(Component) bool) int {
+	labels, components := pbm.ConnectedComponents(conn)
+	remove := make([]bool, len(components)+1)
+	removed := 0
+	for _, c := range components {
+		if !keep(c) {
+			remove[c.Label] = true
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0
+	}
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if remove[labels[y][x]] {
+				pbm.data[y][x] = false
+			}
+		}
+	}
+	return removed
+}
+
+// Despeckle removes the components of the PBM image smaller than minArea
+// pixels and returns the number of components removed.
+func (pbm *PBM) Despeckle(minArea int, conn Connectivity) int {
+	return pbm.FilterComponents(conn, func(c Component) bool { return c.Area >= minArea })
+}
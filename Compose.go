@@ -0,0 +1,264 @@
+package Netpbm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// rescale converts a sample from the range [0, from] to the range [0, to].
+func rescale(v, from, to uint8) uint8 {
+	if from == to {
+		return v
+	}
+	if from == 0 {
+		return 0
+	}
+	return uint8((uint32(v)*uint32(to) + uint32(from)/2) / uint32(from))
+}
+
+// pasteBounds clips the rectangle of a srcWidth x srcHeight image placed at
+// `at` to a dstWidth x dstHeight image and returns the visible range in
+// destination coordinates.
+func pasteBounds(srcWidth, srcHeight, dstWidth, dstHeight int, at Point) (x0, y0, x1, y1 int) {
+	x0, y0 = at.X, at.Y
+	x1, y1 = at.X+srcWidth, at.Y+srcHeight
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if x1 > dstWidth {
+		x1 = dstWidth
+	}
+	if y1 > dstHeight {
+		y1 = dstHeight
+	}
+	return x0, y0, x1, y1
+}
+
+// Paste copies src into the PBM image with its top-left corner at `at`.
+// The parts of src falling outside the image are clipped.
+func (pbm *PBM) Paste(src *PBM, at Point) {
+	x0, y0, x1, y1 := pasteBounds(src.width, src.height, pbm.width, pbm.height, at)
+	for y := y0; y < y1; y++ {
+		if x0 < x1 {
+			copy(pbm.data[y][x0:x1], src.data[y-at.Y][x0-at.X:x1-at.X])
+		}
+	}
+}
+
+// Paste copies src into the PGM image with its top-left corner at `at`.
+// Values are rescaled to the max value of the image and the parts of src
+// falling outside the image are clipped.
+func (pgm *PGM) Paste(src *PGM, at Point) {
+	x0, y0, x1, y1 := pasteBounds(src.width, src.height, pgm.width, pgm.height, at)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			pgm.data[y][x] = rescale(src.data[y-at.Y][x-at.X], src.max, pgm.max)
+		}
+	}
+}
+
+// Paste copies src into the PPM image with its top-left corner at `at`.
+// Values are rescaled to the max value of the image and the parts of src
+// falling outside the image are clipped.
+func (ppm *PPM) Paste(src *PPM, at Point) {
+	x0, y0, x1, y1 := pasteBounds(src.width, src.height, ppm.width, ppm.height, at)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			p := src.data[y-at.Y][x-at.X]
+			ppm.data[y][x] = Pixel{R: rescale(p.R, src.max, ppm.max), G: rescale(p.G, src.max, ppm.max), B: rescale(p.B, src.max, ppm.max)}
+		}
+	}
+}
+
+// maskAlpha returns the opacity in [0, 1] of the mask at (x, y), or 1 when there is no mask.
+func maskAlpha(mask *PGM, x, y int) float64 {
+	if mask == nil || mask.max == 0 {
+		return 1
+	}
+	return float64(mask.data[y][x]) / float64(mask.max)
+}
+
+// checkMask verifies that a mask covers a width x height image.
+func checkMask(mask *PGM, width, height int) error {
+	if mask != nil && (mask.width != width || mask.height != height) {
+		return fmt.Errorf("mask size %d x %d does not match image size %d x %d", mask.width, mask.height, width, height)
+	}
+	return nil
+}
+
+// Overlay blends src over the PGM image with its top-left corner at `at`.
+// mask holds the opacity of each src pixel (0 is transparent, its max value is
+// opaque) and must be the same size as src; a nil mask pastes src opaquely.
+func (pgm *PGM) Overlay(src *PGM, at Point, mask *PGM) error {
+	if err := checkMask(mask, src.width, src.height); err != nil {
+		return err
+	}
+
+	x0, y0, x1, y1 := pasteBounds(src.width, src.height, pgm.width, pgm.height, at)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			alpha := maskAlpha(mask, x-at.X, y-at.Y)
+			fg := float64(rescale(src.data[y-at.Y][x-at.X], src.max, pgm.max))
+			pgm.data[y][x] = clampUint8(alpha*fg+(1-alpha)*float64(pgm.data[y][x]), pgm.max)
+		}
+	}
+	return nil
+}
+
+// Overlay blends src over the PPM image with its top-left corner at `at`.
+// mask holds the opacity of each src pixel (0 is transparent, its max value is
+// opaque) and must be the same size as src; a nil mask pastes src opaquely.
+func (ppm *PPM) Overlay(src *PPM, at Point, mask *PGM) error {
+	if err := checkMask(mask, src.width, src.height); err != nil {
+		return err
+	}
+
+	blend := func(fg, bg uint8, alpha float64) uint8 {
+		return clampUint8(alpha*float64(rescale(fg, src.max, ppm.max))+(1-alpha)*float64(bg), ppm.max)
+	}
+	x0, y0, x1, y1 := pasteBounds(src.width, src.height, ppm.width, ppm.height, at)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			alpha := maskAlpha(mask, x-at.X, y-at.Y)
+			fg, bg := src.data[y-at.Y][x-at.X], ppm.data[y][x]
+			ppm.data[y][x] = Pixel{R: blend(fg.R, bg.R, alpha), G: blend(fg.G, bg.G, alpha), B: blend(fg.B, bg.B, alpha)}
+		}
+	}
+	return nil
+}
+
+// montageLayout computes the cell size and the canvas size of a grid of images.
+func montageLayout(sizes [][2]int, columns, spacing int) (cellWidth, cellHeight, width, height int) {
+	for _, s := range sizes {
+		if s[0] > cellWidth {
+			cellWidth = s[0]
+		}
+		if s[1] > cellHeight {
+			cellHeight = s[1]
+		}
+	}
+	rows := (len(sizes) + columns - 1) / columns
+	width = columns*cellWidth + (columns+1)*spacing
+	height = rows*cellHeight + (rows+1)*spacing
+	return cellWidth, cellHeight, width, height
+}
+
+// montageCell returns the position of image i centered in its grid cell.
+func montageCell(i, columns, spacing, cellWidth, cellHeight, width, height int) Point {
+	col, row := i%columns, i/columns
+	return Point{
+		X: spacing + col*(cellWidth+spacing) + (cellWidth-width)/2,
+		Y: spacing + row*(cellHeight+spacing) + (cellHeight-height)/2,
+	}
+}
+
+// MontagePGM arranges the images in a grid with the given number of columns,
+// like pnmmontage. Every cell is as large as the largest image, images are
+// centered in their cell and cells are separated by spacing pixels of
+// background. The result uses the largest max value of the images.
+func MontagePGM(images []*PGM, columns, spacing int, background uint8) (*PGM, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to arrange")
+	}
+	if columns <= 0 || spacing < 0 {
+		return nil, fmt.Errorf("invalid layout: %d columns, spacing %d", columns, spacing)
+	}
+	if columns > len(images) {
+		columns = len(images)
+	}
+
+	sizes := make([][2]int, len(images))
+	var max uint8
+	for i, img := range images {
+		sizes[i] = [2]int{img.width, img.height}
+		if img.max > max {
+			max = img.max
+		}
+	}
+	cellWidth, cellHeight, width, height := montageLayout(sizes, columns, spacing)
+
+	montage := newPGM(width, height, max, images[0].magicNumber)
+	for y := range montage.data {
+		for x := range montage.data[y] {
+			montage.data[y][x] = background
+		}
+	}
+	for i, img := range images {
+		montage.Paste(img, montageCell(i, columns, spacing, cellWidth, cellHeight, img.width, img.height))
+	}
+	return montage, nil
+}
+
+// MontagePPM arranges the images in a grid with the given number of columns,
+// like pnmmontage. Every cell is as large as the largest image, images are
+// centered in their cell and cells are separated by spacing pixels of
+// background. The result uses the largest max value of the images.
+func MontagePPM(images []*PPM, columns, spacing int, background Pixel) (*PPM, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to arrange")
+	}
+	if columns <= 0 || spacing < 0 {
+		return nil, fmt.Errorf("invalid layout: %d columns, spacing %d", columns, spacing)
+	}
+	if columns > len(images) {
+		columns = len(images)
+	}
+
+	sizes := make([][2]int, len(images))
+	var max uint8
+	for i, img := range images {
+		sizes[i] = [2]int{img.width, img.height}
+		if img.max > max {
+			max = img.max
+		}
+	}
+	cellWidth, cellHeight, width, height := montageLayout(sizes, columns, spacing)
+
+	montage := newPPM(width, height, max, images[0].magicNumber)
+	for y := range montage.data {
+		for x := range montage.data[y] {
+			montage.data[y][x] = background
+		}
+	}
+	for i, img := range images {
+		montage.Paste(img, montageCell(i, columns, spacing, cellWidth, cellHeight, img.width, img.height))
+	}
+	return montage, nil
+}
+
+// Tile returns a width x height PGM image covered with copies of the image, like pnmtile.
+func (pgm *PGM) Tile(width, height int) (*PGM, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %d x %d", width, height)
+	}
+	if pgm.width == 0 || pgm.height == 0 {
+		return nil, errors.New("cannot tile an empty image")
+	}
+	tiled := newPGM(width, height, pgm.max, pgm.magicNumber)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tiled.data[y][x] = pgm.data[y%pgm.height][x%pgm.width]
+		}
+	}
+	return tiled, nil
+}
+
+// Tile returns a width x height PPM image covered with copies of the image, like pnmtile.
+func (ppm *PPM) Tile(width, height int) (*PPM, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %d x %d", width, height)
+	}
+	if ppm.width == 0 || ppm.height == 0 {
+		return nil, errors.New("cannot tile an empty image")
+	}
+	tiled := newPPM(width, height, ppm.max, ppm.magicNumber)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tiled.data[y][x] = ppm.data[y%ppm.height][x%ppm.width]
+		}
+	}
+	return tiled, nil
+}
@@ -0,0 +1,157 @@
+package Netpbm
+
+import "math"
+
+// CompositeOp is a Porter-Duff operator combining a source over a destination.
+type CompositeOp int
+
+const (
+	// CompositeOver draws the source on top of the destination.
+	CompositeOver CompositeOp = iota
+	// CompositeIn keeps the source only where the destination is opaque.
+	CompositeIn
+	// CompositeOut keeps the source only where the destination is transparent.
+	CompositeOut
+	// CompositeAtop draws the source on top of the destination, inside the destination only.
+	CompositeAtop
+	// CompositeXor keeps the source and the destination where they do not overlap.
+	CompositeXor
+)
+
+// BlendMode selects how source and destination colors are mixed where they overlap.
+type BlendMode int
+
+const (
+	// BlendNormal uses the source color.
+	BlendNormal BlendMode = iota
+	// BlendMultiply multiplies the colors, darkening the result.
+	BlendMultiply
+	// BlendScreen inverts, multiplies and inverts the colors, lightening the result.
+	BlendScreen
+	// BlendOverlay multiplies or screens depending on the destination color.
+	BlendOverlay
+	// BlendDarken keeps the darker color.
+	BlendDarken
+	// BlendLighten keeps the lighter color.
+	BlendLighten
+	// BlendDifference uses the absolute difference of the colors.
+	BlendDifference
+	// BlendAdd adds the colors, saturating at white.
+	BlendAdd
+	// BlendSubtract subtracts the source from the destination, saturating at black.
+	BlendSubtract
+)
+
+// blend mixes a destination color cb with a source color cs, both in [0, 1].
+func blend(mode BlendMode, cb, cs float64) float64 {
+	switch mode {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		if cb <= 0.5 {
+			return 2 * cb * cs
+		}
+		return 1 - 2*(1-cb)*(1-cs)
+	case BlendDarken:
+		return math.Min(cb, cs)
+	case BlendLighten:
+		return math.Max(cb, cs)
+	case BlendDifference:
+		return math.Abs(cb - cs)
+	case BlendAdd:
+		return math.Min(1, cb+cs)
+	case BlendSubtract:
+		return math.Max(0, cb-cs)
+	default:
+		return cs
+	}
+}
+
+// porterDuff returns the fractions of the source and of the destination kept by op.
+func porterDuff(op CompositeOp, as, ab float64) (fa, fb float64) {
+	switch op {
+	case CompositeIn:
+		return ab, 0
+	case CompositeOut:
+		return 1 - ab, 0
+	case CompositeAtop:
+		return ab, 1 - as
+	case CompositeXor:
+		return 1 - ab, 1 - as
+	default:
+		return 1, 1 - as
+	}
+}
+
+// Composite combines src into the PPM image with its top-left corner at `at`,
+// using the Porter-Duff operator op and the blend mode mode.
+//
+// srcAlpha and dstAlpha hold the opacity of each pixel of src and of the image
+// (0 is transparent, their max value is opaque) and must match their sizes; a
+// nil alpha means fully opaque. Colors are normalized by the max value of their
+// own image, so images with different max values can be combined. The operator
+// is applied over the area covered by src only, and the resulting alpha channel
+// of the image is returned.
+func (ppm *PPM) Composite(src *PPM, at Point, srcAlpha, dstAlpha *PGM, op CompositeOp, mode BlendMode) (*PGM, error) {
+	if err := checkMask(srcAlpha, src.width, src.height); err != nil {
+		return nil, err
+	}
+	if err := checkMask(dstAlpha, ppm.width, ppm.height); err != nil {
+		return nil, err
+	}
+
+	// Start the resulting alpha channel from the destination one
+	alphaMax := ppm.max
+	if dstAlpha != nil {
+		alphaMax = dstAlpha.max
+	}
+	alpha := newPGM(ppm.width, ppm.height, alphaMax, "P2")
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			if dstAlpha != nil {
+				alpha.data[y][x] = dstAlpha.data[y][x]
+			} else {
+				alpha.data[y][x] = alphaMax
+			}
+		}
+	}
+
+	srcMax, dstMax := float64(src.max), float64(ppm.max)
+	if srcMax == 0 {
+		srcMax = 1
+	}
+	if dstMax == 0 {
+		dstMax = 1
+	}
+	channel := func(cs, cb uint8, as, ab, fa, fb, ao float64) uint8 {
+		s, b := float64(cs)/srcMax, float64(cb)/dstMax
+		// Mix the source with the blend result where the destination is present
+		mixed := (1-ab)*s + ab*blend(mode, b, s)
+		co := as*fa*mixed + ab*fb*b
+		if ao <= 0 {
+			return 0
+		}
+		return clampUint8(co/ao*dstMax, ppm.max)
+	}
+
+	x0, y0, x1, y1 := pasteBounds(src.width, src.height, ppm.width, ppm.height, at)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			as := maskAlpha(srcAlpha, x-at.X, y-at.Y)
+			ab := maskAlpha(dstAlpha, x, y)
+			fa, fb := porterDuff(op, as, ab)
+			ao := as*fa + ab*fb
+
+			cs, cb := src.data[y-at.Y][x-at.X], ppm.data[y][x]
+			ppm.data[y][x] = Pixel{
+				R: channel(cs.R, cb.R, as, ab, fa, fb, ao),
+				G: channel(cs.G, cb.G, as, ab, fa, fb, ao),
+				B: channel(cs.B, cb.B, as, ab, fa, fb, ao),
+			}
+			alpha.data[y][x] = clampUint8(ao*float64(alphaMax), alphaMax)
+		}
+	}
+	return alpha, nil
+}
@@ -0,0 +1,378 @@
+package Netpbm
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Contour is a closed boundary of a black region, made of the centers of the
+// boundary pixels in tracing order.
+type Contour struct {
+	Points []Point
+	// Hole is true for the boundary of a white hole inside a black region.
+	Hole bool
+	// Parent is the index of the enclosing contour, or -1 for an outermost one.
+	Parent int
+}
+
+// PointF is a point with fractional coordinates.
+type PointF struct {
+	X, Y float64
+}
+
+// CurveSegment is a piece of a smoothed contour, starting where the previous
+// segment ends. A corner is made of two straight lines, to C1 then to End;
+// otherwise it is a cubic Bézier curve with control points C1 and C2.
+type CurveSegment struct {
+	Corner      bool
+	C1, C2, End PointF
+}
+
+// VectorOptions controls the vectorization of a PBM image.
+type VectorOptions struct {
+	// Epsilon is the Douglas-Peucker tolerance, in pixels, used to simplify contours.
+	Epsilon float64
+	// Smooth fits Bézier curves to the simplified polygons.
+	Smooth bool
+	// AlphaMax is the corner threshold of the curve fitting: larger values
+	// give rounder shapes. Potrace uses 1.
+	AlphaMax float64
+}
+
+// clockwise lists the 8 neighbor offsets (dy, dx) in clockwise order, starting east.
+var clockwise = [8][2]int{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}}
+
+// direction returns the index in clockwise of the offset from (y, x) to (ny, nx).
+func direction(y, x, ny, nx int) int {
+	for d, o := range clockwise {
+		if o[0] == ny-y && o[1] == nx-x {
+			return d
+		}
+	}
+	return 0
+}
+
+// TraceContours follows the outer and inner boundaries of the black regions of
+// the PBM image with the Suzuki-Abe algorithm. Black regions are 8-connected
+// and holes are 4-connected.
+func (pbm *PBM) TraceContours() []Contour {
+	// Pad the image with a white frame so that no neighbor is out of range
+	f := make([][]int, pbm.height+2)
+	for y := range f {
+		f[y] = make([]int, pbm.width+2)
+	}
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if pbm.data[y][x] {
+				f[y+1][x+1] = 1
+			}
+		}
+	}
+
+	var contours []Contour
+	// index and hole describe each border number; border 1 is the frame
+	index := []int{-1, -1}
+	hole := []bool{false, true}
+	nbd := 1
+
+	for i := 1; i <= pbm.height; i++ {
+		lnbd := 1
+		for j := 1; j <= pbm.width; j++ {
+			if f[i][j] == 0 {
+				continue
+			}
+
+			var startY, startX int
+			isHole := false
+			if f[i][j] == 1 && f[i][j-1] == 0 {
+				startY, startX = i, j-1
+			} else if f[i][j] >= 1 && f[i][j+1] == 0 {
+				startY, startX = i, j+1
+				isHole = true
+				if f[i][j] > 1 {
+					lnbd = f[i][j]
+				}
+			} else {
+				if f[i][j] != 1 {
+					lnbd = absInt(f[i][j])
+				}
+				continue
+			}
+
+			// Find the parent from the type of the last border met on this row
+			nbd++
+			parent := index[lnbd]
+			if isHole == hole[lnbd] && index[lnbd] >= 0 {
+				parent = contours[index[lnbd]].Parent
+			}
+			contours = append(contours, Contour{Hole: isHole, Parent: parent})
+			index = append(index, len(contours)-1)
+			hole = append(hole, isHole)
+			points := traceBorder(f, i, j, startY, startX, nbd)
+			contours[len(contours)-1].Points = points
+
+			if f[i][j] != 1 {
+				lnbd = absInt(f[i][j])
+			}
+		}
+	}
+	return contours
+}
+
+// traceBorder follows the border starting at (i, j), whose first examined
+// neighbor is (startY, startX), marking it with nbd in f.
+func traceBorder(f [][]int, i, j, startY, startX, nbd int) []Point {
+	// Look clockwise from the starting neighbor for a black pixel
+	d0 := direction(i, j, startY, startX)
+	first := -1
+	for k := 0; k < 8; k++ {
+		d := (d0 + k) % 8
+		if f[i+clockwise[d][0]][j+clockwise[d][1]] != 0 {
+			first = d
+			break
+		}
+	}
+	if first < 0 {
+		// Isolated pixel
+		f[i][j] = -nbd
+		return []Point{{X: j - 1, Y: i - 1}}
+	}
+
+	i1, j1 := i+clockwise[first][0], j+clockwise[first][1]
+	i2, j2 := i1, j1
+	i3, j3 := i, j
+	var points []Point
+	for {
+		points = append(points, Point{X: j3 - 1, Y: i3 - 1})
+
+		// Look counterclockwise from the previous pixel for the next one
+		d := direction(i3, j3, i2, j2)
+		eastExamined := false
+		var i4, j4 int
+		for k := 1; k <= 8; k++ {
+			nd := (d - k + 16) % 8
+			ny, nx := i3+clockwise[nd][0], j3+clockwise[nd][1]
+			if f[ny][nx] != 0 {
+				i4, j4 = ny, nx
+				break
+			}
+			if nd == 0 {
+				eastExamined = true
+			}
+		}
+
+		if eastExamined {
+			f[i3][j3] = -nbd
+		} else if f[i3][j3] == 1 {
+			f[i3][j3] = nbd
+		}
+
+		if i4 == i && j4 == j && i3 == i1 && j3 == j1 {
+			return points
+		}
+		i2, j2 = i3, j3
+		i3, j3 = i4, j4
+	}
+}
+
+// absInt returns the absolute value of v.
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// SimplifyPolygon reduces a closed polygon with the Douglas-Peucker algorithm,
+// dropping the vertices closer than epsilon to the simplified outline.
+func SimplifyPolygon(points []Point, epsilon float64) []Point {
+	if len(points) < 4 {
+		return append([]Point(nil), points...)
+	}
+
+	// Split the ring at the vertex farthest from the first one
+	far, farDist := 0, -1.0
+	for i, p := range points {
+		dx, dy := float64(p.X-points[0].X), float64(p.Y-points[0].Y)
+		if d := dx*dx + dy*dy; d > farDist {
+			far, farDist = i, d
+		}
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[far] = true, true
+	ring := append(append([]Point(nil), points...), points[0])
+	douglasPeucker(ring, 0, far, epsilon, keep)
+	douglasPeucker(ring, far, len(points), epsilon, keep)
+
+	var simplified []Point
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// douglasPeucker marks in keep the vertices of points[first:last] needed to
+// stay within epsilon of the chain.
+func douglasPeucker(points []Point, first, last int, epsilon float64, keep []bool) {
+	if last <= first+1 {
+		return
+	}
+	a, b := points[first], points[last]
+	index, maxDist := -1, epsilon
+	for i := first + 1; i < last; i++ {
+		if d := segmentDistance(points[i], a, b); d > maxDist {
+			index, maxDist = i, d
+		}
+	}
+	if index < 0 {
+		return
+	}
+	keep[index%len(keep)] = true
+	douglasPeucker(points, first, index, epsilon, keep)
+	douglasPeucker(points, index, last, epsilon, keep)
+}
+
+// segmentDistance returns the distance from p to the segment [a, b].
+func segmentDistance(p, a, b Point) float64 {
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	px, py := float64(p.X-a.X), float64(p.Y-a.Y)
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return math.Hypot(px, py)
+	}
+	t := math.Max(0, math.Min(1, (px*dx+py*dy)/length))
+	return math.Hypot(px-t*dx, py-t*dy)
+}
+
+// FitCurves smooths a closed polygon into Bézier curves the way potrace does.
+// Each vertex becomes a curve between the midpoints of its two edges, or a
+// corner when the vertex sticks out so much that its smoothness parameter
+// reaches alphaMax.
+func FitCurves(polygon []Point, alphaMax float64) []CurveSegment {
+	n := len(polygon)
+	if n < 3 {
+		return nil
+	}
+
+	segments := make([]CurveSegment, n)
+	for j := 0; j < n; j++ {
+		vi, vj, vk := polygon[(j+n-1)%n], polygon[j], polygon[(j+1)%n]
+		pi := PointF{X: float64(vi.X), Y: float64(vi.Y)}
+		pj := PointF{X: float64(vj.X), Y: float64(vj.Y)}
+		pk := PointF{X: float64(vk.X), Y: float64(vk.Y)}
+		end := interval(0.5, pk, pj)
+
+		// Distance of the vertex from the chord of its neighbors
+		alpha := 4.0 / 3.0
+		if denom := math.Abs(pk.X-pi.X) + math.Abs(pk.Y-pi.Y); denom != 0 {
+			dd := math.Abs((pj.X-pi.X)*(pk.Y-pi.Y)-(pk.X-pi.X)*(pj.Y-pi.Y)) / denom
+			alpha = 0
+			if dd > 1 {
+				alpha = 1 - 1/dd
+			}
+			alpha /= 0.75
+		}
+
+		if alpha >= alphaMax {
+			segments[j] = CurveSegment{Corner: true, C1: pj, End: end}
+			continue
+		}
+		alpha = math.Max(0.55, math.Min(1, alpha))
+		segments[j] = CurveSegment{
+			C1:  interval(0.5+0.5*alpha, pi, pj),
+			C2:  interval(0.5+0.5*alpha, pk, pj),
+			End: end,
+		}
+	}
+	return segments
+}
+
+// interval returns the point at fraction t of the way from a to b.
+func interval(t float64, a, b PointF) PointF {
+	return PointF{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+}
+
+// PolygonPath returns the SVG path data of a closed polygon. Coordinates are
+// moved to the center of their pixel.
+func PolygonPath(polygon []Point) string {
+	var sb strings.Builder
+	for i, p := range polygon {
+		if i == 0 {
+			fmt.Fprintf(&sb, "M%g %g", float64(p.X)+0.5, float64(p.Y)+0.5)
+		} else {
+			fmt.Fprintf(&sb, "L%g %g", float64(p.X)+0.5, float64(p.Y)+0.5)
+		}
+	}
+	if len(polygon) > 0 {
+		sb.WriteString("Z")
+	}
+	return sb.String()
+}
+
+// CurvePath returns the SVG path data of a closed smoothed contour.
+// Coordinates are moved to the center of their pixel.
+func CurvePath(segments []CurveSegment) string {
+	if len(segments) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	start := segments[len(segments)-1].End
+	fmt.Fprintf(&sb, "M%.3f %.3f", start.X+0.5, start.Y+0.5)
+	for _, s := range segments {
+		if s.Corner {
+			fmt.Fprintf(&sb, "L%.3f %.3fL%.3f %.3f", s.C1.X+0.5, s.C1.Y+0.5, s.End.X+0.5, s.End.Y+0.5)
+		} else {
+			fmt.Fprintf(&sb, "C%.3f %.3f %.3f %.3f %.3f %.3f", s.C1.X+0.5, s.C1.Y+0.5, s.C2.X+0.5, s.C2.Y+0.5, s.End.X+0.5, s.End.Y+0.5)
+		}
+	}
+	sb.WriteString("Z")
+	return sb.String()
+}
+
+// Polygons traces the contours of the PBM image and simplifies them with the
+// given tolerance.
+func (pbm *PBM) Polygons(epsilon float64) [][]Point {
+	contours := pbm.TraceContours()
+	polygons := make([][]Point, len(contours))
+	for i, c := range contours {
+		polygons[i] = SimplifyPolygon(c.Points, epsilon)
+	}
+	return polygons
+}
+
+// SaveSVG vectorizes the PBM image and saves it as an SVG file.
+// Holes are rendered with the even-odd fill rule.
+func (pbm *PBM) SaveSVG(filename string, opts VectorOptions) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintf(writer, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", pbm.width, pbm.height, pbm.width, pbm.height)
+	fmt.Fprint(writer, "<path fill=\"black\" fill-rule=\"evenodd\" d=\"")
+	for _, polygon := range pbm.Polygons(opts.Epsilon) {
+		if opts.Smooth && len(polygon) >= 3 {
+			fmt.Fprint(writer, CurvePath(FitCurves(polygon, opts.AlphaMax)))
+		} else {
+			fmt.Fprint(writer, PolygonPath(polygon))
+		}
+	}
+	_, err = fmt.Fprint(writer, "\"/>\n</svg>\n")
+	if err != nil {
+		return fmt.Errorf("error writing SVG data: %v", err)
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("error flushing writer: %v", err)
+	}
+	return nil
+}
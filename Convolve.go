@@ -0,0 +1,380 @@
+package Netpbm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BorderMode selects the value of the pixels outside the image when filtering.
+type BorderMode int
+
+const (
+	// BorderClamp repeats the pixels of the edge.
+	BorderClamp BorderMode = iota
+	// BorderReflect mirrors the image at its edges, the edge pixels included (cba|abc|cba).
+	BorderReflect
+	// BorderWrap tiles the image.
+	BorderWrap
+	// BorderConstant uses ConvolveOptions.Constant.
+	BorderConstant
+)
+
+// Kernel is a convolution kernel. Its weights are divided by its divisor.
+// Kernels built by NewIntKernel are accumulated in integers and divided only
+// once per pixel; the others are accumulated in floating point.
+type Kernel struct {
+	weights [][]float64
+	// integer holds the weights of integer kernels, nil for the others
+	integer       [][]int
+	divisor       float64
+	width, height int
+}
+
+// ConvolveOptions controls convolution.
+type ConvolveOptions struct {
+	Border BorderMode
+	// Constant is the value of every channel outside the image with BorderConstant.
+	Constant uint8
+	// Normalize divides the kernel by the sum of its weights, when not zero.
+	Normalize bool
+	// Bias is added to every result, which allows kernels with negative weights
+	// such as emboss to produce visible output.
+	Bias float64
+}
+
+// NewKernel returns the kernel with the given weights, given row by row. The
+// center of the kernel is at (width/2, height/2).
+func NewKernel(weights [][]float64) (*Kernel, error) {
+	if len(weights) == 0 || len(weights[0]) == 0 {
+		return nil, errors.New("empty kernel")
+	}
+	k := &Kernel{weights: make([][]float64, len(weights)), divisor: 1, width: len(weights[0]), height: len(weights)}
+	for y, row := range weights {
+		if len(row) != k.width {
+			return nil, fmt.Errorf("kernel row %d has %d weights instead of %d", y, len(row), k.width)
+		}
+		k.weights[y] = append([]float64(nil), row...)
+	}
+	return k, nil
+}
+
+// NewIntKernel returns the kernel with the given integer weights, given row by
+// row, divided by divisor. Convolve accumulates its products in integers.
+func NewIntKernel(weights [][]int, divisor int) (*Kernel, error) {
+	if divisor == 0 {
+		return nil, errors.New("kernel divisor is zero")
+	}
+	float := make([][]float64, len(weights))
+	for y, row := range weights {
+		float[y] = make([]float64, len(row))
+		for x, w := range row {
+			float[y][x] = float64(w)
+		}
+	}
+	k, err := NewKernel(float)
+	if err != nil {
+		return nil, err
+	}
+	k.integer = make([][]int, len(weights))
+	for y, row := range weights {
+		k.integer[y] = append([]int(nil), row...)
+	}
+	k.divisor = float64(divisor)
+	return k, nil
+}
+
+// Size returns the width and height of the kernel.
+func (k *Kernel) Size() (int, int) {
+	return k.width, k.height
+}
+
+// Sum returns the sum of the weights of the kernel, after division.
+func (k *Kernel) Sum() float64 {
+	sum := 0.0
+	for _, row := range k.weights {
+		for _, w := range row {
+			sum += w
+		}
+	}
+	return sum / k.divisor
+}
+
+// Normalize scales the kernel so that its weights sum to 1. Kernels summing to
+// 0, such as edge detectors, are left unchanged.
+func (k *Kernel) Normalize() {
+	if sum := k.Sum(); sum != 0 {
+		k.divisor *= sum
+	}
+}
+
+// borderIndex maps the coordinate i to a coordinate inside [0, n) according to
+// the border mode, or returns -1 for a constant border.
+func borderIndex(i, n int, mode BorderMode) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch mode {
+	case BorderClamp:
+		return clampInt(i, 0, n-1)
+	case BorderReflect:
+		period := 2 * n
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - 1 - i
+		}
+		return i
+	case BorderWrap:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		return i
+	}
+	return -1
+}
+
+// checkBorder returns an error if mode is not a known border mode.
+func checkBorder(mode BorderMode) error {
+	if mode < BorderClamp || mode > BorderConstant {
+		return fmt.Errorf("unknown border mode: %d", mode)
+	}
+	return nil
+}
+
+// convolvePlane applies the kernel to a plane of values. Like pnmconvol, the
+// kernel is not flipped: the weight at (i, j) multiplies the pixel at offset
+// (i - width/2, j - height/2).
+func convolvePlane(plane [][]float64, width, height int, k *Kernel, border BorderMode, constant float64) [][]float64 {
+	cx, cy := k.width/2, k.height/2
+	out := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		out[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			sum := 0.0
+			for j, row := range k.weights {
+				sy := borderIndex(y+j-cy, height, border)
+				for i, w := range row {
+					if w == 0 {
+						continue
+					}
+					sx := borderIndex(x+i-cx, width, border)
+					if sx < 0 || sy < 0 {
+						sum += w * constant
+					} else {
+						sum += w * plane[sy][sx]
+					}
+				}
+			}
+			out[y][x] = sum / k.divisor
+		}
+	}
+	return out
+}
+
+// convolveLevels applies the kernel to a channel of levels like convolvePlane.
+// Integer kernels are accumulated exactly in integers, and the sum is divided
+// by the divisor once at the end.
+func convolveLevels(data [][]uint8, width, height int, k *Kernel, border BorderMode, constant uint8) [][]float64 {
+	if k.integer == nil {
+		plane := make([][]float64, height)
+		for y := range plane {
+			plane[y] = make([]float64, width)
+			for x := range plane[y] {
+				plane[y][x] = float64(data[y][x])
+			}
+		}
+		return convolvePlane(plane, width, height, k, border, float64(constant))
+	}
+
+	cx, cy := k.width/2, k.height/2
+	out := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		out[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			sum := 0
+			for j, row := range k.integer {
+				sy := borderIndex(y+j-cy, height, border)
+				for i, w := range row {
+					if w == 0 {
+						continue
+					}
+					sx := borderIndex(x+i-cx, width, border)
+					if sx < 0 || sy < 0 {
+						sum += w * int(constant)
+					} else {
+						sum += w * int(data[sy][sx])
+					}
+				}
+			}
+			out[y][x] = float64(sum) / k.divisor
+		}
+	}
+	return out
+}
+
+// convolveSeparable applies the horizontal then the vertical kernel to a plane of values.
+func convolveSeparable(plane [][]float64, width, height int, horizontal, vertical []float64, border BorderMode, constant float64) [][]float64 {
+	cx, cy := len(horizontal)/2, len(vertical)/2
+	rows := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		rows[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			sum := 0.0
+			for i, w := range horizontal {
+				if sx := borderIndex(x+i-cx, width, border); sx < 0 {
+					sum += w * constant
+				} else {
+					sum += w * plane[y][sx]
+				}
+			}
+			rows[y][x] = sum
+		}
+	}
+
+	// Rows outside a constant border are constant too
+	outside := 0.0
+	for _, w := range horizontal {
+		outside += w * constant
+	}
+	out := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		out[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			sum := 0.0
+			for j, w := range vertical {
+				if sy := borderIndex(y+j-cy, height, border); sy < 0 {
+					sum += w * outside
+				} else {
+					sum += w * rows[sy][x]
+				}
+			}
+			out[y][x] = sum
+		}
+	}
+	return out
+}
+
+// normalizeVector returns v divided by the sum of its values, when not zero.
+func normalizeVector(v []float64) []float64 {
+	sum := 0.0
+	for _, w := range v {
+		sum += w
+	}
+	if sum == 0 {
+		return v
+	}
+	normalized := make([]float64, len(v))
+	for i, w := range v {
+		normalized[i] = w / sum
+	}
+	return normalized
+}
+
+// setPlane stores a plane of values plus bias in the PGM image, rounded and clamped.
+func (pgm *PGM) setPlane(plane [][]float64, bias float64) {
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			pgm.data[y][x] = clampUint8(plane[y][x]+bias, pgm.max)
+		}
+	}
+}
+
+// setPlanes stores the red, green and blue planes plus bias in the PPM image, rounded and clamped.
+func (ppm *PPM) setPlanes(r, g, b [][]float64, bias float64) {
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			ppm.data[y][x] = Pixel{
+				R: clampUint8(r[y][x]+bias, ppm.max),
+				G: clampUint8(g[y][x]+bias, ppm.max),
+				B: clampUint8(b[y][x]+bias, ppm.max),
+			}
+		}
+	}
+}
+
+// prepare validates the options and returns the kernel to apply.
+func (opts ConvolveOptions) prepare(k *Kernel) (*Kernel, error) {
+	if k == nil {
+		return nil, errors.New("nil kernel")
+	}
+	if err := checkBorder(opts.Border); err != nil {
+		return nil, err
+	}
+	if opts.Normalize {
+		normalized := *k
+		normalized.Normalize()
+		return &normalized, nil
+	}
+	return k, nil
+}
+
+// prepareSeparable validates the options and returns the vectors to apply.
+func (opts ConvolveOptions) prepareSeparable(horizontal, vertical []float64) ([]float64, []float64, error) {
+	if len(horizontal) == 0 || len(vertical) == 0 {
+		return nil, nil, errors.New("empty kernel")
+	}
+	if err := checkBorder(opts.Border); err != nil {
+		return nil, nil, err
+	}
+	if opts.Normalize {
+		return normalizeVector(horizontal), normalizeVector(vertical), nil
+	}
+	return horizontal, vertical, nil
+}
+
+// Convolve applies the kernel to the PGM image.
+func (pgm *PGM) Convolve(k *Kernel, opts ConvolveOptions) error {
+	k, err := opts.prepare(k)
+	if err != nil {
+		return err
+	}
+	pgm.setPlane(convolveLevels(pgm.data, pgm.width, pgm.height, k, opts.Border, opts.Constant), opts.Bias)
+	return nil
+}
+
+// Convolve applies the kernel to every channel of the PPM image.
+func (ppm *PPM) Convolve(k *Kernel, opts ConvolveOptions) error {
+	k, err := opts.prepare(k)
+	if err != nil {
+		return err
+	}
+	c := ppm.channels()
+	ppm.setPlanes(
+		convolveLevels(c[0], ppm.width, ppm.height, k, opts.Border, opts.Constant),
+		convolveLevels(c[1], ppm.width, ppm.height, k, opts.Border, opts.Constant),
+		convolveLevels(c[2], ppm.width, ppm.height, k, opts.Border, opts.Constant),
+		opts.Bias)
+	return nil
+}
+
+// ConvolveSeparable applies the kernel whose weight at (i, j) is
+// horizontal[i] * vertical[j] to the PGM image, in two passes of one
+// dimension, which is much faster for large kernels such as blurs.
+func (pgm *PGM) ConvolveSeparable(horizontal, vertical []float64, opts ConvolveOptions) error {
+	horizontal, vertical, err := opts.prepareSeparable(horizontal, vertical)
+	if err != nil {
+		return err
+	}
+	pgm.setPlane(convolveSeparable(pgm.plane(), pgm.width, pgm.height, horizontal, vertical, opts.Border, float64(opts.Constant)), opts.Bias)
+	return nil
+}
+
+// ConvolveSeparable applies the separable kernel to every channel of the PPM
+// image. See PGM.ConvolveSeparable.
+func (ppm *PPM) ConvolveSeparable(horizontal, vertical []float64, opts ConvolveOptions) error {
+	horizontal, vertical, err := opts.prepareSeparable(horizontal, vertical)
+	if err != nil {
+		return err
+	}
+	constant := float64(opts.Constant)
+	r, g, b := ppm.planes()
+	ppm.setPlanes(
+		convolveSeparable(r, ppm.width, ppm.height, horizontal, vertical, opts.Border, constant),
+		convolveSeparable(g, ppm.width, ppm.height, horizontal, vertical, opts.Border, constant),
+		convolveSeparable(b, ppm.width, ppm.height, horizontal, vertical, opts.Border, constant),
+		opts.Bias)
+	return nil
+}
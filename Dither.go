@@ -0,0 +1,361 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// DitherMethod selects the dithering algorithm.
+type DitherMethod int
+
+const (
+	// DitherFloydSteinberg diffuses the error to 4 neighbors.
+	DitherFloydSteinberg DitherMethod = iota
+	// DitherJarvisJudiceNinke diffuses the error to 12 neighbors over two rows.
+	DitherJarvisJudiceNinke
+	// DitherStucki diffuses the error to 12 neighbors over two rows, with sharper weights.
+	DitherStucki
+	// DitherAtkinson diffuses three quarters of the error to 6 neighbors.
+	DitherAtkinson
+	// DitherSierra diffuses the error to 10 neighbors over two rows.
+	DitherSierra
+	// DitherBayer compares the pixels to a recursive Bayer matrix.
+	DitherBayer
+	// DitherBlueNoise compares the pixels to a 64x64 blue noise matrix.
+	DitherBlueNoise
+)
+
+// DitherOptions controls dithering.
+type DitherOptions struct {
+	Method DitherMethod
+	// Serpentine scans every other row from right to left with error diffusion,
+	// which avoids the diagonal artifacts of a raster scan.
+	Serpentine bool
+	// MatrixSize is the side of the Bayer matrix, a power of two from 2 to 16;
+	// 0 selects 8.
+	MatrixSize int
+}
+
+// diffusion is a share of the quantization error given to the pixel at (dx, dy).
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+// diffusionKernels holds the error distribution of every error diffusion method.
+var diffusionKernels = map[DitherMethod][]diffusion{
+	DitherFloydSteinberg: {
+		{1, 0, 7.0 / 16},
+		{-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	},
+	DitherJarvisJudiceNinke: {
+		{1, 0, 7.0 / 48}, {2, 0, 5.0 / 48},
+		{-2, 1, 3.0 / 48}, {-1, 1, 5.0 / 48}, {0, 1, 7.0 / 48}, {1, 1, 5.0 / 48}, {2, 1, 3.0 / 48},
+		{-2, 2, 1.0 / 48}, {-1, 2, 3.0 / 48}, {0, 2, 5.0 / 48}, {1, 2, 3.0 / 48}, {2, 2, 1.0 / 48},
+	},
+	DitherStucki: {
+		{1, 0, 8.0 / 42}, {2, 0, 4.0 / 42},
+		{-2, 1, 2.0 / 42}, {-1, 1, 4.0 / 42}, {0, 1, 8.0 / 42}, {1, 1, 4.0 / 42}, {2, 1, 2.0 / 42},
+		{-2, 2, 1.0 / 42}, {-1, 2, 2.0 / 42}, {0, 2, 4.0 / 42}, {1, 2, 2.0 / 42}, {2, 2, 1.0 / 42},
+	},
+	DitherAtkinson: {
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8},
+		{-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8},
+		{0, 2, 1.0 / 8},
+	},
+	DitherSierra: {
+		{1, 0, 5.0 / 32}, {2, 0, 3.0 / 32},
+		{-2, 1, 2.0 / 32}, {-1, 1, 4.0 / 32}, {0, 1, 5.0 / 32}, {1, 1, 4.0 / 32}, {2, 1, 2.0 / 32},
+		{-1, 2, 2.0 / 32}, {0, 2, 3.0 / 32}, {1, 2, 2.0 / 32},
+	},
+}
+
+// bayerMatrix returns the Bayer matrix of the given size, a power of two.
+func bayerMatrix(size int) [][]int {
+	m := [][]int{{0}}
+	for n := 1; n < size; n *= 2 {
+		next := make([][]int, 2*n)
+		for y := range next {
+			next[y] = make([]int, 2*n)
+		}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				v := 4 * m[y][x]
+				next[y][x] = v
+				next[y][x+n] = v + 2
+				next[y+n][x] = v + 3
+				next[y+n][x+n] = v + 1
+			}
+		}
+		m = next
+	}
+	return m
+}
+
+var (
+	blueNoiseOnce   sync.Once
+	blueNoiseMatrix [][]int
+)
+
+// blueNoise returns the 64x64 blue noise matrix, generated on first use with
+// the void-and-cluster method of Ulichney.
+func blueNoise() [][]int {
+	blueNoiseOnce.Do(func() {
+		blueNoiseMatrix = voidAndCluster(64, 1.5)
+	})
+	return blueNoiseMatrix
+}
+
+// voidAndCluster returns a size x size matrix ranking every cell from 0 to
+// size*size-1 so that the cells of every rank below a threshold are spread as
+// evenly as possible, on a torus.
+func voidAndCluster(size int, sigma float64) [][]int {
+	n := size * size
+
+	// Gaussian weight of every toroidal offset
+	weight := make([]float64, n)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			ddx, ddy := math.Min(float64(dx), float64(size-dx)), math.Min(float64(dy), float64(size-dy))
+			weight[dy*size+dx] = math.Exp(-(ddx*ddx + ddy*ddy) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(p int, on bool) {
+		pattern[p] = on
+		sign := 1.0
+		if !on {
+			sign = -1
+		}
+		px, py := p%size, p/size
+		for q := 0; q < n; q++ {
+			dx, dy := (q%size-px+size)%size, (q/size-py+size)%size
+			energy[q] += sign * weight[dy*size+dx]
+		}
+	}
+	// tightestCluster returns the set cell with the highest energy, largestVoid
+	// the empty cell with the lowest
+	tightestCluster := func() int {
+		best := -1
+		for p := 0; p < n; p++ {
+			if pattern[p] && (best < 0 || energy[p] > energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+	largestVoid := func() int {
+		best := -1
+		for p := 0; p < n; p++ {
+			if !pattern[p] && (best < 0 || energy[p] < energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+
+	// Initial pattern: a tenth of the cells at random, moved from the
+	// tightest clusters to the largest voids until stable
+	random := rand.New(rand.NewSource(1))
+	ones := n / 10
+	for _, p := range random.Perm(n)[:ones] {
+		toggle(p, true)
+	}
+	for {
+		cluster := tightestCluster()
+		toggle(cluster, false)
+		void := largestVoid()
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	prototype := append([]bool(nil), pattern...)
+	prototypeEnergy := append([]float64(nil), energy...)
+
+	rank := make([]int, n)
+	// Ranks below the prototype: remove the tightest clusters
+	for r := ones - 1; r >= 0; r-- {
+		p := tightestCluster()
+		toggle(p, false)
+		rank[p] = r
+	}
+	// Ranks above: fill the largest voids
+	copy(pattern, prototype)
+	copy(energy, prototypeEnergy)
+	for r := ones; r < n; r++ {
+		p := largestVoid()
+		toggle(p, true)
+		rank[p] = r
+	}
+
+	matrix := make([][]int, size)
+	for y := range matrix {
+		matrix[y] = rank[y*size : (y+1)*size]
+	}
+	return matrix
+}
+
+// dither quantizes a plane of values from 0 to max into levels 0 to newMax.
+func dither(plane [][]float64, width, height int, max, newMax uint8, opts DitherOptions) ([][]uint8, error) {
+	if newMax < 1 {
+		return nil, fmt.Errorf("invalid max value: %d", newMax)
+	}
+	out := make([][]uint8, height)
+	for y := range out {
+		out[y] = make([]uint8, width)
+	}
+	scale := float64(newMax) / float64(max)
+
+	switch opts.Method {
+	case DitherBayer, DitherBlueNoise:
+		var matrix [][]int
+		if opts.Method == DitherBayer {
+			size := opts.MatrixSize
+			if size == 0 {
+				size = 8
+			}
+			if size < 2 || size > 16 || size&(size-1) != 0 {
+				return nil, fmt.Errorf("invalid Bayer matrix size: %d", size)
+			}
+			matrix = bayerMatrix(size)
+		} else {
+			matrix = blueNoise()
+		}
+		size := len(matrix)
+		cells := float64(size * size)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				q := plane[y][x] * scale
+				t := (float64(matrix[y%size][x%size]) + 0.5) / cells
+				level := math.Floor(q)
+				if q-level > t {
+					level++
+				}
+				out[y][x] = uint8(math.Max(0, math.Min(level, float64(newMax))))
+			}
+		}
+		return out, nil
+	}
+
+	kernel, ok := diffusionKernels[opts.Method]
+	if !ok {
+		return nil, fmt.Errorf("unknown dither method: %d", opts.Method)
+	}
+	// The rows being diffused into are kept in a scratch copy
+	work := make([][]float64, height)
+	for y := range work {
+		work[y] = make([]float64, width)
+		for x := range work[y] {
+			work[y][x] = plane[y][x] * scale
+		}
+	}
+	for y := 0; y < height; y++ {
+		reverse := opts.Serpentine && y%2 == 1
+		for i := 0; i < width; i++ {
+			x := i
+			if reverse {
+				x = width - 1 - i
+			}
+			q := work[y][x]
+			level := math.Max(0, math.Min(math.Floor(q+0.5), float64(newMax)))
+			out[y][x] = uint8(level)
+			err := q - level
+			for _, d := range kernel {
+				dx := d.dx
+				if reverse {
+					dx = -dx
+				}
+				nx, ny := x+dx, y+d.dy
+				if nx >= 0 && nx < width && ny < height {
+					work[ny][nx] += err * d.weight
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// plane returns the levels of the PGM image as floating point values.
+func (pgm *PGM) plane() [][]float64 {
+	plane := make([][]float64, pgm.height)
+	for y := range plane {
+		plane[y] = make([]float64, pgm.width)
+		for x := range plane[y] {
+			plane[y][x] = float64(pgm.data[y][x])
+		}
+	}
+	return plane
+}
+
+// planes returns the red, green and blue channels of the PPM image as floating point values.
+func (ppm *PPM) planes() (r, g, b [][]float64) {
+	r, g, b = make([][]float64, ppm.height), make([][]float64, ppm.height), make([][]float64, ppm.height)
+	for y := 0; y < ppm.height; y++ {
+		r[y], g[y], b[y] = make([]float64, ppm.width), make([]float64, ppm.width), make([]float64, ppm.width)
+		for x := 0; x < ppm.width; x++ {
+			p := ppm.data[y][x]
+			r[y][x], g[y][x], b[y][x] = float64(p.R), float64(p.G), float64(p.B)
+		}
+	}
+	return r, g, b
+}
+
+// ToPBMDither converts the PGM image to PBM with dithering, so that the
+// density of black pixels follows the gray levels.
+func (pgm *PGM) ToPBMDither(opts DitherOptions) (*PBM, error) {
+	levels, err := dither(pgm.plane(), pgm.width, pgm.height, pgm.max, 1, opts)
+	if err != nil {
+		return nil, err
+	}
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			pbm.data[y][x] = levels[y][x] == 0
+		}
+	}
+	return pbm, nil
+}
+
+// ToPBMDither converts the PPM image to PBM with dithering of the average of
+// the three channels, as in ToPBM.
+func (ppm *PPM) ToPBMDither(opts DitherOptions) (*PBM, error) {
+	return ppm.ToPGM().ToPBMDither(opts)
+}
+
+// Dither reduces the max value of the PGM image to newMax, dithering the
+// gray levels instead of rounding them.
+func (pgm *PGM) Dither(newMax uint8, opts DitherOptions) error {
+	levels, err := dither(pgm.plane(), pgm.width, pgm.height, pgm.max, newMax, opts)
+	if err != nil {
+		return err
+	}
+	pgm.data = levels
+	pgm.max = newMax
+	return nil
+}
+
+// Dither reduces the max value of the PPM image to newMax, dithering every
+// channel independently.
+func (ppm *PPM) Dither(newMax uint8, opts DitherOptions) error {
+	r, g, b := ppm.planes()
+	var channels [3][][]uint8
+	for i, plane := range [][][]float64{r, g, b} {
+		levels, err := dither(plane, ppm.width, ppm.height, ppm.max, newMax, opts)
+		if err != nil {
+			return err
+		}
+		channels[i] = levels
+	}
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			ppm.data[y][x] = Pixel{R: channels[0][y][x], G: channels[1][y][x], B: channels[2][y][x]}
+		}
+	}
+	ppm.max = newMax
+	return nil
+}
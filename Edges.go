@@ -0,0 +1,197 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// EdgeOperator selects the kernels estimating the gradient of an image.
+type EdgeOperator int
+
+const (
+	// EdgeSobel smooths the derivative with weights 1, 2, 1.
+	EdgeSobel EdgeOperator = iota
+	// EdgeScharr smooths the derivative with weights 3, 10, 3, which is more isotropic.
+	EdgeScharr
+	// EdgePrewitt smooths the derivative with weights 1, 1, 1.
+	EdgePrewitt
+)
+
+// edgeKernels returns the smoothing and derivative vectors of the operator.
+func edgeKernels(op EdgeOperator) ([]float64, []float64, error) {
+	derivative := []float64{-1, 0, 1}
+	switch op {
+	case EdgeSobel:
+		return []float64{1, 2, 1}, derivative, nil
+	case EdgeScharr:
+		return []float64{3, 10, 3}, derivative, nil
+	case EdgePrewitt:
+		return []float64{1, 1, 1}, derivative, nil
+	}
+	return nil, nil, fmt.Errorf("unknown edge operator: %d", op)
+}
+
+// gradients returns the horizontal and vertical derivatives of a plane,
+// scaled so that a step of one level gives a derivative of one.
+func gradients(plane [][]float64, width, height int, op EdgeOperator) ([][]float64, [][]float64, error) {
+	smooth, derivative, err := edgeKernels(op)
+	if err != nil {
+		return nil, nil, err
+	}
+	smooth = normalizeVector(smooth)
+	gx := convolveSeparable(plane, width, height, derivative, smooth, BorderClamp, 0)
+	gy := convolveSeparable(plane, width, height, smooth, derivative, BorderClamp, 0)
+	return gx, gy, nil
+}
+
+// gradientMaps returns the magnitude and direction maps of the gradients.
+func gradientMaps(gx, gy [][]float64, width, height int, max uint8) (*PGM, *PGM) {
+	magnitude := newPGM(width, height, max, "P2")
+	direction := newPGM(width, height, max, "P2")
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			magnitude.data[y][x] = clampUint8(math.Hypot(gx[y][x], gy[y][x]), max)
+			angle := math.Atan2(gy[y][x], gx[y][x])
+			direction.data[y][x] = clampUint8((angle+math.Pi)/(2*math.Pi)*float64(max), max)
+		}
+	}
+	return magnitude, direction
+}
+
+// Gradient computes the gradient of the PGM image with the given operator and
+// returns its magnitude and its direction as PGM images with the same max
+// value. A step from black to white gives the max value; stronger diagonal
+// gradients are clamped. The direction maps the angles from -π to π, measured
+// from the x axis towards the y axis (downwards), onto 0 to the max value.
+func (pgm *PGM) Gradient(op EdgeOperator) (magnitude, direction *PGM, err error) {
+	gx, gy, err := gradients(pgm.plane(), pgm.width, pgm.height, op)
+	if err != nil {
+		return nil, nil, err
+	}
+	magnitude, direction = gradientMaps(gx, gy, pgm.width, pgm.height, pgm.max)
+	return magnitude, direction, nil
+}
+
+// Gradient computes the gradient of the luminance of the PPM image. See PGM.Gradient.
+func (ppm *PPM) Gradient(op EdgeOperator) (magnitude, direction *PGM, err error) {
+	return ppm.luminance().Gradient(op)
+}
+
+// Laplacian returns the absolute value of the Laplacian of the PGM image,
+// computed with the 4-neighbor kernel, as a PGM image with the same max value.
+func (pgm *PGM) Laplacian() *PGM {
+	kernel, _ := NewIntKernel([][]int{{0, 1, 0}, {1, -4, 1}, {0, 1, 0}}, 1)
+	laplacian := convolvePlane(pgm.plane(), pgm.width, pgm.height, kernel, BorderClamp, 0)
+	out := newPGM(pgm.width, pgm.height, pgm.max, "P2")
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			out.data[y][x] = clampUint8(math.Abs(laplacian[y][x]), pgm.max)
+		}
+	}
+	return out
+}
+
+// Laplacian returns the absolute value of the Laplacian of the luminance of the PPM image.
+func (ppm *PPM) Laplacian() *PGM {
+	return ppm.luminance().Laplacian()
+}
+
+// Canny detects the edges of the PGM image with the Canny detector: the image
+// is smoothed by a Gaussian of standard deviation sigma (0 skips it), the
+// Sobel gradient is thinned to its local maxima along the gradient direction,
+// and the maxima above high, with the maxima above low connected to them, are
+// kept. Thresholds are gradient magnitudes in gray levels, as in Gradient.
+// Edges are black in the returned PBM image.
+func (pgm *PGM) Canny(sigma, low, high float64) (*PBM, error) {
+	if sigma < 0 {
+		return nil, fmt.Errorf("invalid sigma: %g", sigma)
+	}
+	if low > high {
+		return nil, fmt.Errorf("low threshold %g above high threshold %g", low, high)
+	}
+	plane := pgm.plane()
+	if sigma > 0 {
+		plane = gaussianBlurPlane(plane, pgm.width, pgm.height, sigma)
+	}
+	gx, gy, _ := gradients(plane, pgm.width, pgm.height, EdgeSobel)
+
+	magnitude := make([][]float64, pgm.height)
+	for y := range magnitude {
+		magnitude[y] = make([]float64, pgm.width)
+		for x := range magnitude[y] {
+			magnitude[y][x] = math.Hypot(gx[y][x], gy[y][x])
+		}
+	}
+	at := func(x, y int) float64 {
+		if x < 0 || x >= pgm.width || y < 0 || y >= pgm.height {
+			return 0
+		}
+		return magnitude[y][x]
+	}
+
+	// Non-maximum suppression along the gradient direction, rounded to 45°
+	strong := make([][]bool, pgm.height)
+	weak := make([][]bool, pgm.height)
+	for y := 0; y < pgm.height; y++ {
+		strong[y] = make([]bool, pgm.width)
+		weak[y] = make([]bool, pgm.width)
+		for x := 0; x < pgm.width; x++ {
+			m := magnitude[y][x]
+			if m == 0 || m < low {
+				continue
+			}
+			angle := math.Atan2(gy[y][x], gx[y][x]) * 180 / math.Pi
+			if angle < 0 {
+				angle += 180
+			}
+			var dx, dy int
+			switch {
+			case angle < 22.5 || angle >= 157.5:
+				dx, dy = 1, 0
+			case angle < 67.5:
+				dx, dy = 1, 1
+			case angle < 112.5:
+				dx, dy = 0, 1
+			default:
+				dx, dy = -1, 1
+			}
+			if m < at(x+dx, y+dy) || m < at(x-dx, y-dy) {
+				continue
+			}
+			weak[y][x] = true
+			strong[y][x] = m >= high
+		}
+	}
+
+	// Hysteresis: grow the strong edges through the weak ones
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+	var stack []Point
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			if strong[y][x] {
+				pbm.data[y][x] = true
+				stack = append(stack, Point{X: x, Y: y})
+			}
+		}
+	}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				x, y := p.X+dx, p.Y+dy
+				if x < 0 || x >= pgm.width || y < 0 || y >= pgm.height || pbm.data[y][x] || !weak[y][x] {
+					continue
+				}
+				pbm.data[y][x] = true
+				stack = append(stack, Point{X: x, Y: y})
+			}
+		}
+	}
+	return pbm, nil
+}
+
+// Canny detects the edges of the luminance of the PPM image. See PGM.Canny.
+func (ppm *PPM) Canny(sigma, low, high float64) (*PBM, error) {
+	return ppm.luminance().Canny(sigma, low, high)
+}
@@ -0,0 +1,443 @@
+package Netpbm
+
+import "fmt"
+
+// Runs returns the run lengths of every row of the PBM image. Runs alternate
+// between white and black and always start with a white run, which is 0 when
+// the row starts with a black pixel.
+func (pbm *PBM) Runs() [][]int {
+	runs := make([][]int, pbm.height)
+	for y, row := range pbm.data {
+		color, length := false, 0
+		for _, v := range row {
+			if v != color {
+				runs[y] = append(runs[y], length)
+				color, length = v, 0
+			}
+			length++
+		}
+		runs[y] = append(runs[y], length)
+	}
+	return runs
+}
+
+// PBMFromRuns builds a PBM image from the run lengths of its rows, in the
+// format returned by Runs.
+func PBMFromRuns(width int, runs [][]int) (*PBM, error) {
+	pbm := newPBM(width, len(runs), "P4")
+	for y, row := range runs {
+		x, color := 0, false
+		for _, length := range row {
+			if length < 0 || x+length > width {
+				return nil, fmt.Errorf("invalid runs at line %d", y)
+			}
+			for i := 0; i < length; i++ {
+				pbm.data[y][x+i] = color
+			}
+			x += length
+			color = !color
+		}
+		if x != width {
+			return nil, fmt.Errorf("runs of line %d cover %d pixels instead of %d", y, x, width)
+		}
+	}
+	return pbm, nil
+}
+
+// Terminating codes for runs of 0 to 63 pixels (ITU-T T.4, tables 2 and 3)
+var whiteTerminating = [64]string{
+	"00110101", "000111", "0111", "1000", "1011", "1100", "1110", "1111",
+	"10011", "10100", "00111", "01000", "001000", "000011", "110100", "110101",
+	"101010", "101011", "0100111", "0001100", "0001000", "0010111", "0000011", "0000100",
+	"0101000", "0101011", "0010011", "0100100", "0011000", "00000010", "00000011", "00011010",
+	"00011011", "00010010", "00010011", "00010100", "00010101", "00010110", "00010111", "00101000",
+	"00101001", "00101010", "00101011", "00101100", "00101101", "00000100", "00000101", "00001010",
+	"00001011", "01010010", "01010011", "01010100", "01010101", "00100100", "00100101", "01011000",
+	"01011001", "01011010", "01011011", "01001010", "01001011", "00110010", "00110011", "00110100",
+}
+
+var blackTerminating = [64]string{
+	"0000110111", "010", "11", "10", "011", "0011", "0010", "00011",
+	"000101", "000100", "0000100", "0000101", "0000111", "00000100", "00000111", "000011000",
+	"0000010111", "0000011000", "0000001000", "00001100111", "00001101000", "00001101100", "00000110111", "00000101000",
+	"00000010111", "00000011000", "000011001010", "000011001011", "000011001100", "000011001101", "000001101000", "000001101001",
+	"000001101010", "000001101011", "000011010010", "000011010011", "000011010100", "000011010101", "000011010110", "000011010111",
+	"000001101100", "000001101101", "000011011010", "000011011011", "000001010100", "000001010101", "000001010110", "000001010111",
+	"000001100100", "000001100101", "000001010010", "000001010011", "000000100100", "000000110111", "000000111000", "000000100111",
+	"000000101000", "000001011000", "000001011001", "000000101011", "000000101100", "000001011010", "000001100110", "000001100111",
+}
+
+// Make-up codes for runs of 64 to 1728 pixels, in steps of 64
+var whiteMakeup = [27]string{
+	"11011", "10010", "010111", "0110111", "00110110", "00110111", "01100100", "01100101", "01101000",
+	"01100111", "011001100", "011001101", "011010010", "011010011", "011010100", "011010101", "011010110",
+	"011010111", "011011000", "011011001", "011011010", "011011011", "010011000", "010011001", "010011010",
+	"011000", "010011011",
+}
+
+var blackMakeup = [27]string{
+	"0000001111", "000011001000", "000011001001", "000001011011", "000000110011", "000000110100", "000000110101", "0000001101100", "0000001101101",
+	"0000001001010", "0000001001011", "0000001001100", "0000001001101", "0000001110010", "0000001110011", "0000001110100", "0000001110101", "0000001110110",
+	"0000001110111", "0000001010010", "0000001010011", "0000001010100", "0000001010101", "0000001011010", "0000001011011", "0000001100100", "0000001100101",
+}
+
+// Extended make-up codes for runs of 1792 to 2560 pixels, shared by both colors
+var extendedMakeup = [13]string{
+	"00000001000", "00000001100", "00000001101", "000000010010", "000000010011", "000000010100", "000000010101",
+	"000000010110", "000000010111", "000000011100", "000000011101", "000000011110", "000000011111",
+}
+
+// Two-dimensional coding modes (ITU-T T.4, table 4)
+const (
+	faxEOL        = "000000000001"
+	faxPass       = "0001"
+	faxHorizontal = "001"
+)
+
+// faxVertical holds the vertical mode codes for a1 - b1 from -3 to 3
+var faxVertical = [7]string{"0000010", "000010", "010", "1", "011", "000011", "0000011"}
+
+// faxCodeKey packs a code and its length into a lookup key.
+func faxCodeKey(code string) uint32 {
+	var v uint32
+	for _, c := range code {
+		v = v<<1 | uint32(c-'0')
+	}
+	return uint32(len(code))<<16 | v
+}
+
+// faxRunTable maps the codes of one color to their run lengths.
+func faxRunTable(terminating [64]string, makeup [27]string) map[uint32]int {
+	table := make(map[uint32]int)
+	for run, code := range terminating {
+		table[faxCodeKey(code)] = run
+	}
+	for i, code := range makeup {
+		table[faxCodeKey(code)] = (i + 1) * 64
+	}
+	for i, code := range extendedMakeup {
+		table[faxCodeKey(code)] = 1792 + i*64
+	}
+	return table
+}
+
+var (
+	whiteRuns = faxRunTable(whiteTerminating, whiteMakeup)
+	blackRuns = faxRunTable(blackTerminating, blackMakeup)
+)
+
+// Two-dimensional modes as decoded by readMode
+const (
+	modePass = 10 + iota
+	modeHorizontal
+	modeEOL
+)
+
+// faxModes maps the mode codes to vertical offsets or to a mode constant.
+var faxModes = func() map[uint32]int {
+	modes := map[uint32]int{
+		faxCodeKey(faxPass):       modePass,
+		faxCodeKey(faxHorizontal): modeHorizontal,
+		faxCodeKey(faxEOL):        modeEOL,
+	}
+	for i, code := range faxVertical {
+		modes[faxCodeKey(code)] = i - 3
+	}
+	return modes
+}()
+
+// bitWriter accumulates bits, most significant bit first.
+type bitWriter struct {
+	data  []byte
+	nbits int
+}
+
+// writeCode appends a code written as a string of '0' and '1'.
+func (w *bitWriter) writeCode(code string) {
+	for _, c := range code {
+		if w.nbits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if c == '1' {
+			w.data[len(w.data)-1] |= 0x80 >> uint(w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+// writeRun appends the codes of a run of the given color.
+func (w *bitWriter) writeRun(run int, black bool) {
+	terminating, makeup := &whiteTerminating, &whiteMakeup
+	if black {
+		terminating, makeup = &blackTerminating, &blackMakeup
+	}
+	for run >= 2560 {
+		w.writeCode(extendedMakeup[len(extendedMakeup)-1])
+		run -= 2560
+	}
+	if m := run / 64; m > 0 {
+		if m >= 28 {
+			w.writeCode(extendedMakeup[m-28])
+		} else {
+			w.writeCode(makeup[m-1])
+		}
+		run -= m * 64
+	}
+	w.writeCode(terminating[run])
+}
+
+// bitReader reads bits, most significant bit first.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+// readBit returns the next bit.
+func (r *bitReader) readBit() (uint32, error) {
+	if r.pos >= len(r.data)*8 {
+		return 0, fmt.Errorf("unexpected end of data")
+	}
+	bit := uint32(r.data[r.pos/8]>>uint(7-r.pos%8)) & 1
+	r.pos++
+	return bit, nil
+}
+
+// readCode reads bits until they form one of the codes of table.
+func (r *bitReader) readCode(table map[uint32]int) (int, error) {
+	start := r.pos
+	var code uint32
+	for length := 1; length <= 13; length++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | bit
+		if v, ok := table[uint32(length)<<16|code]; ok {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid code at bit %d", start)
+}
+
+// readRun reads the make-up and terminating codes of a run of the given color.
+func (r *bitReader) readRun(black bool) (int, error) {
+	table := whiteRuns
+	if black {
+		table = blackRuns
+	}
+	total := 0
+	for {
+		v, err := r.readCode(table)
+		if err != nil {
+			return 0, err
+		}
+		total += v
+		if v < 64 {
+			return total, nil
+		}
+	}
+}
+
+// skipEOL consumes the end-of-line codes, with their fill bits, found at the
+// current position and returns how many were found.
+func (r *bitReader) skipEOL() int {
+	count := 0
+	for {
+		start := r.pos
+		zeros := 0
+		bit, err := r.readBit()
+		for err == nil && bit == 0 {
+			zeros++
+			bit, err = r.readBit()
+		}
+		if err != nil || zeros < 11 {
+			r.pos = start
+			return count
+		}
+		count++
+	}
+}
+
+// EncodeG3 compresses the PBM image with the CCITT Group 3 one-dimensional
+// (Modified Huffman) coding of ITU-T T.4. Every line starts with an EOL code
+// and the data ends with a return-to-control sequence of six EOL codes.
+func (pbm *PBM) EncodeG3() []byte {
+	w := &bitWriter{}
+	for _, row := range pbm.Runs() {
+		w.writeCode(faxEOL)
+		for i, run := range row {
+			w.writeRun(run, i%2 == 1)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		w.writeCode(faxEOL)
+	}
+	return w.data
+}
+
+// DecodeG3 decompresses CCITT Group 3 one-dimensional data into a PBM image
+// of the given size. EOL codes and their fill bits are optional.
+func DecodeG3(data []byte, width, height int) (*PBM, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %d x %d", width, height)
+	}
+	pbm := newPBM(width, height, "P4")
+	r := &bitReader{data: data}
+	for y := 0; y < height; y++ {
+		r.skipEOL()
+		x, black := 0, false
+		for x < width {
+			run, err := r.readRun(black)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding line %d: %v", y, err)
+			}
+			if x+run > width {
+				return nil, fmt.Errorf("run overflows line %d", y)
+			}
+			for i := x; i < x+run; i++ {
+				pbm.data[y][i] = black
+			}
+			x += run
+			black = !black
+		}
+	}
+	return pbm, nil
+}
+
+// nextChange returns the first position after a0 where the row stops having
+// the given color, or the width of the row if there is none.
+func nextChange(row []bool, a0 int, color bool) int {
+	for x := a0 + 1; x < len(row); x++ {
+		if x >= 0 && row[x] != color {
+			return x
+		}
+	}
+	return len(row)
+}
+
+// referenceChanges returns b1, the first changing element of the reference
+// line after a0 whose color is opposite to color, and b2, the next one.
+func referenceChanges(ref []bool, a0 int, color bool) (int, int) {
+	b1 := len(ref)
+	for x := a0 + 1; x < len(ref); x++ {
+		if x < 0 {
+			continue
+		}
+		prev := false
+		if x > 0 {
+			prev = ref[x-1]
+		}
+		if ref[x] != color && prev == color {
+			b1 = x
+			break
+		}
+	}
+	return b1, nextChange(ref, b1, !color)
+}
+
+// EncodeG4 compresses the PBM image with the CCITT Group 4 two-dimensional
+// coding of ITU-T T.6. The data ends with an end-of-facsimile-block code.
+func (pbm *PBM) EncodeG4() []byte {
+	w := &bitWriter{}
+	ref := make([]bool, pbm.width)
+	for _, row := range pbm.data {
+		a0, color := -1, false
+		for a0 < pbm.width {
+			a1 := nextChange(row, a0, color)
+			b1, b2 := referenceChanges(ref, a0, color)
+			switch {
+			case b2 < a1:
+				w.writeCode(faxPass)
+				a0 = b2
+			case a1-b1 >= -3 && a1-b1 <= 3:
+				w.writeCode(faxVertical[a1-b1+3])
+				a0, color = a1, !color
+			default:
+				a2 := nextChange(row, a1, !color)
+				start := a0
+				if start < 0 {
+					start = 0
+				}
+				w.writeCode(faxHorizontal)
+				w.writeRun(a1-start, color)
+				w.writeRun(a2-a1, !color)
+				a0 = a2
+			}
+		}
+		ref = row
+	}
+	w.writeCode(faxEOL)
+	w.writeCode(faxEOL)
+	return w.data
+}
+
+// DecodeG4 decompresses CCITT Group 4 data into a PBM image of the given size.
+func DecodeG4(data []byte, width, height int) (*PBM, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %d x %d", width, height)
+	}
+	pbm := newPBM(width, height, "P4")
+	r := &bitReader{data: data}
+	ref := make([]bool, width)
+	for y := 0; y < height; y++ {
+		row := pbm.data[y]
+		fill := func(from, to int, color bool) error {
+			if from < 0 {
+				from = 0
+			}
+			if to < from || to > width {
+				return fmt.Errorf("invalid changing element %d at line %d", to, y)
+			}
+			for x := from; x < to; x++ {
+				row[x] = color
+			}
+			return nil
+		}
+
+		a0, color := -1, false
+		for a0 < width {
+			mode, err := r.readCode(faxModes)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding line %d: %v", y, err)
+			}
+			b1, b2 := referenceChanges(ref, a0, color)
+			switch mode {
+			case modePass:
+				if err := fill(a0, b2, color); err != nil {
+					return nil, err
+				}
+				a0 = b2
+			case modeHorizontal:
+				start := a0
+				if start < 0 {
+					start = 0
+				}
+				run1, err := r.readRun(color)
+				if err != nil {
+					return nil, fmt.Errorf("error decoding line %d: %v", y, err)
+				}
+				run2, err := r.readRun(!color)
+				if err != nil {
+					return nil, fmt.Errorf("error decoding line %d: %v", y, err)
+				}
+				if err := fill(start, start+run1, color); err != nil {
+					return nil, err
+				}
+				if err := fill(start+run1, start+run1+run2, !color); err != nil {
+					return nil, err
+				}
+				a0 = start + run1 + run2
+			case modeEOL:
+				return nil, fmt.Errorf("unexpected end of data at line %d", y)
+			default:
+				a1 := b1 + mode
+				if err := fill(a0, a1, color); err != nil {
+					return nil, err
+				}
+				a0, color = a1, !color
+			}
+		}
+		ref = row
+	}
+	return pbm, nil
+}
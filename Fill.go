@@ -0,0 +1,99 @@
+package Netpbm
+
+// FloodFill sets to value the region of pixels of the PBM image that have the
+// color of seed and are connected to it, and returns the number of pixels
+// changed. Nothing changes when seed is outside the image or already has value.
+func (pbm *PBM) FloodFill(seed Point, value bool, conn Connectivity) int {
+	if seed.X < 0 || seed.Y < 0 || seed.X >= pbm.width || seed.Y >= pbm.height {
+		return 0
+	}
+	target := pbm.data[seed.Y][seed.X]
+	if target == value {
+		return 0
+	}
+
+	// Scanline fill: fill a whole run, then queue the runs touching it above and below
+	filled := 0
+	stack := []Point{seed}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		row := pbm.data[p.Y]
+		if row[p.X] != target {
+			continue
+		}
+
+		left, right := p.X, p.X
+		for left > 0 && row[left-1] == target {
+			left--
+		}
+		for right < pbm.width-1 && row[right+1] == target {
+			right++
+		}
+		for x := left; x <= right; x++ {
+			row[x] = value
+		}
+		filled += right - left + 1
+
+		lo, hi := left, right
+		if conn == Connectivity8 {
+			lo, hi = clampInt(left-1, 0, pbm.width-1), clampInt(right+1, 0, pbm.width-1)
+		}
+		for _, y := range [2]int{p.Y - 1, p.Y + 1} {
+			if y < 0 || y >= pbm.height {
+				continue
+			}
+			inRun := false
+			for x := lo; x <= hi; x++ {
+				if pbm.data[y][x] == target {
+					if !inRun {
+						stack = append(stack, Point{X: x, Y: y})
+						inRun = true
+					}
+				} else {
+					inRun = false
+				}
+			}
+		}
+	}
+	return filled
+}
+
+// FillHoles makes black the white regions of the PBM image that do not reach
+// the border of the image, and returns the number of pixels filled. conn is
+// the connectivity of the white regions.
+func (pbm *PBM) FillHoles(conn Connectivity) int {
+	// Flood the white regions touching the border in a copy of the image
+	reach := newPBM(pbm.width, pbm.height, pbm.magicNumber)
+	for y := range reach.data {
+		copy(reach.data[y], pbm.data[y])
+	}
+	for x := 0; x < pbm.width; x++ {
+		reach.FloodFill(Point{X: x, Y: 0}, true, conn)
+		reach.FloodFill(Point{X: x, Y: pbm.height - 1}, true, conn)
+	}
+	for y := 0; y < pbm.height; y++ {
+		reach.FloodFill(Point{X: 0, Y: y}, true, conn)
+		reach.FloodFill(Point{X: pbm.width - 1, Y: y}, true, conn)
+	}
+
+	// Whatever is still white is a hole
+	filled := 0
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if !reach.data[y][x] {
+				pbm.data[y][x] = true
+				filled++
+			}
+		}
+	}
+	return filled
+}
+
+// ClearBorder removes the components of the PBM image that touch the border
+// of the image and returns the number of components removed.
+func (pbm *PBM) ClearBorder(conn Connectivity) int {
+	return pbm.FilterComponents(conn, func(c Component) bool {
+		return c.Bounds.Min.X > 0 && c.Bounds.Min.Y > 0 && c.Bounds.Max.X < pbm.width && c.Bounds.Max.Y < pbm.height
+	})
+}
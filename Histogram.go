@@ -0,0 +1,265 @@
+package Netpbm
+
+import "math"
+
+// Histogram counts the pixels of every level of a channel, from 0 to the max
+// value of the image.
+type Histogram struct {
+	Counts []int
+}
+
+// HistogramStats summarizes the distribution of a histogram.
+type HistogramStats struct {
+	Count    int
+	Min, Max int
+	Median   int
+	Mean     float64
+	StdDev   float64
+	// Entropy is the Shannon entropy of the levels, in bits.
+	Entropy float64
+}
+
+// newHistogram returns an empty histogram for levels 0 to max.
+func newHistogram(max uint8) *Histogram {
+	return &Histogram{Counts: make([]int, int(max)+1)}
+}
+
+// add counts one pixel of level v; values above the max value count as the max value.
+func (h *Histogram) add(v uint8) {
+	if int(v) >= len(h.Counts) {
+		v = uint8(len(h.Counts) - 1)
+	}
+	h.Counts[v]++
+}
+
+// Histogram returns the histogram of the PGM image.
+func (pgm *PGM) Histogram() *Histogram {
+	h := newHistogram(pgm.max)
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			h.add(pgm.data[y][x])
+		}
+	}
+	return h
+}
+
+// Histograms returns the histograms of the red, green and blue channels of the PPM image.
+func (ppm *PPM) Histograms() (r, g, b *Histogram) {
+	r, g, b = newHistogram(ppm.max), newHistogram(ppm.max), newHistogram(ppm.max)
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			r.add(ppm.data[y][x].R)
+			g.add(ppm.data[y][x].G)
+			b.add(ppm.data[y][x].B)
+		}
+	}
+	return r, g, b
+}
+
+// Total returns the number of pixels counted.
+func (h *Histogram) Total() int {
+	total := 0
+	for _, n := range h.Counts {
+		total += n
+	}
+	return total
+}
+
+// Cumulative returns the cumulative histogram: the number of pixels at or below every level.
+func (h *Histogram) Cumulative() []int {
+	cumulative := make([]int, len(h.Counts))
+	sum := 0
+	for i, n := range h.Counts {
+		sum += n
+		cumulative[i] = sum
+	}
+	return cumulative
+}
+
+// Percentile returns the lowest level at or below which at least p percent of the pixels lie.
+func (h *Histogram) Percentile(p float64) int {
+	total := h.Total()
+	target := int(math.Ceil(p / 100 * float64(total)))
+	if target < 1 {
+		target = 1
+	}
+	sum := 0
+	for i, n := range h.Counts {
+		sum += n
+		if sum >= target {
+			return i
+		}
+	}
+	return len(h.Counts) - 1
+}
+
+// Stats computes the statistics of the histogram.
+func (h *Histogram) Stats() HistogramStats {
+	stats := HistogramStats{Min: -1}
+	var sum, sumSquares float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		if stats.Min < 0 {
+			stats.Min = i
+		}
+		stats.Max = i
+		stats.Count += n
+		sum += float64(i) * float64(n)
+		sumSquares += float64(i) * float64(i) * float64(n)
+	}
+	if stats.Count == 0 {
+		stats.Min = 0
+		return stats
+	}
+
+	total := float64(stats.Count)
+	stats.Mean = sum / total
+	stats.StdDev = math.Sqrt(math.Max(0, sumSquares/total-stats.Mean*stats.Mean))
+	stats.Median = h.Percentile(50)
+	for _, n := range h.Counts {
+		if n > 0 {
+			p := float64(n) / total
+			stats.Entropy -= p * math.Log2(p)
+		}
+	}
+	return stats
+}
+
+// equalization returns the lookup table spreading the levels of h evenly over [0, max].
+func (h *Histogram) equalization(max uint8) []uint8 {
+	cumulative := h.Cumulative()
+	total := cumulative[len(cumulative)-1]
+	lut := make([]uint8, len(cumulative))
+
+	// The first occupied level maps to 0
+	first := 0
+	for _, c := range cumulative {
+		if c > 0 {
+			first = c
+			break
+		}
+	}
+	for i, c := range cumulative {
+		if total == first {
+			lut[i] = uint8(i)
+			continue
+		}
+		lut[i] = clampUint8(float64(c-first)/float64(total-first)*float64(max), max)
+	}
+	return lut
+}
+
+// matching returns the lookup table giving h the distribution of ref. Levels
+// of ref are rescaled from refMax to max.
+func (h *Histogram) matching(ref *Histogram, refMax, max uint8) []uint8 {
+	src, dst := h.Cumulative(), ref.Cumulative()
+	srcTotal, dstTotal := float64(src[len(src)-1]), float64(dst[len(dst)-1])
+	lut := make([]uint8, len(src))
+	if srcTotal == 0 || dstTotal == 0 {
+		for i := range lut {
+			lut[i] = uint8(i)
+		}
+		return lut
+	}
+
+	r := 0
+	for i, c := range src {
+		for r < len(dst)-1 && float64(dst[r])/dstTotal < float64(c)/srcTotal {
+			r++
+		}
+		lut[i] = rescale(uint8(r), refMax, max)
+	}
+	return lut
+}
+
+// stretching returns the lookup table mapping [lo, hi] linearly onto [0, max].
+func stretching(lo, hi int, max uint8) []uint8 {
+	lut := make([]uint8, int(max)+1)
+	for i := range lut {
+		if hi <= lo {
+			lut[i] = uint8(i)
+			continue
+		}
+		lut[i] = clampUint8(float64(i-lo)*float64(max)/float64(hi-lo), max)
+	}
+	return lut
+}
+
+// applyTable replaces every level of the PGM image with its entry in lut.
+func (pgm *PGM) applyTable(lut []uint8) {
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			v := int(pgm.data[y][x])
+			if v >= len(lut) {
+				v = len(lut) - 1
+			}
+			pgm.data[y][x] = lut[v]
+		}
+	}
+}
+
+// applyTables replaces every level of the channels of the PPM image with its
+// entry in the lookup table of the channel.
+func (ppm *PPM) applyTables(r, g, b []uint8) {
+	lookup := func(lut []uint8, v uint8) uint8 {
+		if int(v) >= len(lut) {
+			return lut[len(lut)-1]
+		}
+		return lut[v]
+	}
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			p := ppm.data[y][x]
+			ppm.data[y][x] = Pixel{R: lookup(r, p.R), G: lookup(g, p.G), B: lookup(b, p.B)}
+		}
+	}
+}
+
+// Equalize spreads the gray levels of the PGM image so that its histogram is as flat as possible.
+func (pgm *PGM) Equalize() {
+	pgm.applyTable(pgm.Histogram().equalization(pgm.max))
+}
+
+// Equalize equalizes the histogram of each channel of the PPM image independently.
+func (ppm *PPM) Equalize() {
+	r, g, b := ppm.Histograms()
+	ppm.applyTables(r.equalization(ppm.max), g.equalization(ppm.max), b.equalization(ppm.max))
+}
+
+// MatchHistogram remaps the gray levels of the PGM image so that its
+// histogram matches the histogram of ref.
+func (pgm *PGM) MatchHistogram(ref *PGM) {
+	pgm.applyTable(pgm.Histogram().matching(ref.Histogram(), ref.max, pgm.max))
+}
+
+// MatchHistogram remaps each channel of the PPM image so that its histogram
+// matches the histogram of the same channel of ref.
+func (ppm *PPM) MatchHistogram(ref *PPM) {
+	r, g, b := ppm.Histograms()
+	refR, refG, refB := ref.Histograms()
+	ppm.applyTables(r.matching(refR, ref.max, ppm.max), g.matching(refG, ref.max, ppm.max), b.matching(refB, ref.max, ppm.max))
+}
+
+// StretchContrast stretches the gray levels of the PGM image to the full
+// range, ignoring the darkest low percent and the brightest high percent of
+// the pixels, which are clipped.
+func (pgm *PGM) StretchContrast(low, high float64) {
+	h := pgm.Histogram()
+	pgm.applyTable(stretching(h.Percentile(low), h.Percentile(100-high), pgm.max))
+}
+
+// StretchContrast stretches the levels of the PPM image to the full range,
+// ignoring the darkest low percent and the brightest high percent of the
+// samples, which are clipped. The same stretch is applied to all channels so
+// that colors keep their balance.
+func (ppm *PPM) StretchContrast(low, high float64) {
+	r, g, b := ppm.Histograms()
+	all := newHistogram(ppm.max)
+	for i := range all.Counts {
+		all.Counts[i] = r.Counts[i] + g.Counts[i] + b.Counts[i]
+	}
+	lut := stretching(all.Percentile(low), all.Percentile(100-high), ppm.max)
+	ppm.applyTables(lut, lut, lut)
+}
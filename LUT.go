@@ -0,0 +1,239 @@
+package Netpbm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// checkTable returns an error if lut does not map every level from 0 to max to a level from 0 to max.
+func checkTable(lut []uint8, max uint8) error {
+	if len(lut) < int(max)+1 {
+		return fmt.Errorf("lookup table has %d entries instead of %d", len(lut), int(max)+1)
+	}
+	for i, v := range lut[:int(max)+1] {
+		if v > max {
+			return fmt.Errorf("lookup table maps %d to %d, above the max value %d", i, v, max)
+		}
+	}
+	return nil
+}
+
+// ApplyLUT replaces every gray level v of the PGM image with lut[v]. The table
+// must have an entry for every level from 0 to the max value, and no entry
+// above the max value.
+func (pgm *PGM) ApplyLUT(lut []uint8) error {
+	if err := checkTable(lut, pgm.max); err != nil {
+		return err
+	}
+	pgm.applyTable(lut)
+	return nil
+}
+
+// ApplyLUT replaces every level of the red, green and blue channels of the PPM
+// image with its entry in the table of the channel. See PGM.ApplyLUT.
+func (ppm *PPM) ApplyLUT(r, g, b []uint8) error {
+	for _, lut := range [][]uint8{r, g, b} {
+		if err := checkTable(lut, ppm.max); err != nil {
+			return err
+		}
+	}
+	ppm.applyTables(r, g, b)
+	return nil
+}
+
+// table returns the lookup table applying f to every level from 0 to max,
+// rounded and clamped.
+func table(max uint8, f func(v float64) float64) []uint8 {
+	lut := make([]uint8, int(max)+1)
+	for i := range lut {
+		lut[i] = clampUint8(f(float64(i)), max)
+	}
+	return lut
+}
+
+// gammaTable returns the lookup table of the gamma correction v' = max * (v / max)^(1/gamma).
+func gammaTable(gamma float64, max uint8) ([]uint8, error) {
+	if gamma <= 0 {
+		return nil, fmt.Errorf("invalid gamma: %g", gamma)
+	}
+	m := float64(max)
+	return table(max, func(v float64) float64 { return m * math.Pow(v/m, 1/gamma) }), nil
+}
+
+// brightnessContrastTable returns the lookup table scaling the levels by
+// contrast around the middle level, then adding brightness times max.
+func brightnessContrastTable(brightness, contrast float64, max uint8) ([]uint8, error) {
+	if contrast < 0 {
+		return nil, fmt.Errorf("invalid contrast: %g", contrast)
+	}
+	m := float64(max)
+	return table(max, func(v float64) float64 { return (v-m/2)*contrast + m/2 + brightness*m }), nil
+}
+
+// levelsTable returns the lookup table mapping [inBlack, inWhite] onto
+// [outBlack, outWhite] with the given gamma, clipping the levels outside the input range.
+func levelsTable(inBlack, inWhite uint8, gamma float64, outBlack, outWhite, max uint8) ([]uint8, error) {
+	if inWhite <= inBlack {
+		return nil, fmt.Errorf("invalid input range: %d to %d", inBlack, inWhite)
+	}
+	if inWhite > max || outBlack > max || outWhite > max {
+		return nil, fmt.Errorf("levels above the max value %d", max)
+	}
+	if gamma <= 0 {
+		return nil, fmt.Errorf("invalid gamma: %g", gamma)
+	}
+	return table(max, func(v float64) float64 {
+		t := math.Max(0, math.Min(1, (v-float64(inBlack))/float64(inWhite-inBlack)))
+		return float64(outBlack) + (float64(outWhite)-float64(outBlack))*math.Pow(t, 1/gamma)
+	}), nil
+}
+
+// curveTable returns the lookup table of the curve through the control
+// points, where X is the input level and Y the output level. The curve is
+// piecewise linear, or a natural cubic spline when spline is set, and is flat
+// beyond the first and last points.
+func curveTable(points []Point, spline bool, max uint8) ([]uint8, error) {
+	if len(points) < 2 {
+		return nil, errors.New("a curve needs at least 2 points")
+	}
+	sorted := append([]Point(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].X < sorted[j].X })
+	for i, p := range sorted {
+		if p.X < 0 || p.X > int(max) || p.Y < 0 || p.Y > int(max) {
+			return nil, fmt.Errorf("curve point (%d, %d) outside 0 to %d", p.X, p.Y, max)
+		}
+		if i > 0 && p.X == sorted[i-1].X {
+			return nil, fmt.Errorf("two curve points at level %d", p.X)
+		}
+	}
+
+	n := len(sorted)
+	x, y := make([]float64, n), make([]float64, n)
+	for i, p := range sorted {
+		x[i], y[i] = float64(p.X), float64(p.Y)
+	}
+	// Second derivatives of the natural spline, zero at both ends
+	second := make([]float64, n)
+	if spline && n > 2 {
+		// Thomas algorithm on the tridiagonal system of the inner points
+		c, d := make([]float64, n), make([]float64, n)
+		for i := 1; i < n-1; i++ {
+			h0, h1 := x[i]-x[i-1], x[i+1]-x[i]
+			rhs := 6 * ((y[i+1]-y[i])/h1 - (y[i]-y[i-1])/h0)
+			diag := 2 * (h0 + h1)
+			if i > 1 {
+				diag -= h0 * c[i-1]
+				rhs -= h0 * d[i-1]
+			}
+			c[i], d[i] = h1/diag, rhs/diag
+		}
+		for i := n - 2; i >= 1; i-- {
+			second[i] = d[i] - c[i]*second[i+1]
+		}
+	}
+
+	segment := 0
+	return table(max, func(v float64) float64 {
+		if v <= x[0] {
+			return y[0]
+		}
+		if v >= x[n-1] {
+			return y[n-1]
+		}
+		for v > x[segment+1] {
+			segment++
+		}
+		h := x[segment+1] - x[segment]
+		a, b := (x[segment+1]-v)/h, (v-x[segment])/h
+		return a*y[segment] + b*y[segment+1] + ((a*a*a-a)*second[segment]+(b*b*b-b)*second[segment+1])*h*h/6
+	}), nil
+}
+
+// posterizeTable returns the lookup table reducing the levels to the given
+// number of evenly spaced levels.
+func posterizeTable(levels int, max uint8) ([]uint8, error) {
+	if levels < 2 || levels > int(max)+1 {
+		return nil, fmt.Errorf("invalid number of levels: %d", levels)
+	}
+	m, steps := float64(max), float64(levels-1)
+	return table(max, func(v float64) float64 { return math.Round(v/m*steps) * m / steps }), nil
+}
+
+// applyTableOrError applies the lookup table, unless err is set, and returns err.
+func (pgm *PGM) applyTableOrError(lut []uint8, err error) error {
+	if err != nil {
+		return err
+	}
+	pgm.applyTable(lut)
+	return nil
+}
+
+// applyTableOrError applies the lookup table to all channels, unless err is set, and returns err.
+func (ppm *PPM) applyTableOrError(lut []uint8, err error) error {
+	if err != nil {
+		return err
+	}
+	ppm.applyTables(lut, lut, lut)
+	return nil
+}
+
+// Gamma applies the gamma correction v' = max * (v / max)^(1/gamma) to the
+// PGM image, as pnmgamma does: gammas above 1 brighten the mid-tones.
+func (pgm *PGM) Gamma(gamma float64) error {
+	return pgm.applyTableOrError(gammaTable(gamma, pgm.max))
+}
+
+// Gamma applies the gamma correction to every channel of the PPM image. See PGM.Gamma.
+func (ppm *PPM) Gamma(gamma float64) error {
+	return ppm.applyTableOrError(gammaTable(gamma, ppm.max))
+}
+
+// BrightnessContrast multiplies the distance of every gray level of the PGM
+// image to the middle level by contrast (1 leaves it unchanged), then adds
+// brightness times the max value (from -1 to 1).
+func (pgm *PGM) BrightnessContrast(brightness, contrast float64) error {
+	return pgm.applyTableOrError(brightnessContrastTable(brightness, contrast, pgm.max))
+}
+
+// BrightnessContrast adjusts every channel of the PPM image. See PGM.BrightnessContrast.
+func (ppm *PPM) BrightnessContrast(brightness, contrast float64) error {
+	return ppm.applyTableOrError(brightnessContrastTable(brightness, contrast, ppm.max))
+}
+
+// Levels maps the gray levels from inBlack to inWhite of the PGM image onto
+// outBlack to outWhite, through a gamma correction; levels outside the input
+// range are clipped. outBlack may be above outWhite to invert the image.
+func (pgm *PGM) Levels(inBlack, inWhite uint8, gamma float64, outBlack, outWhite uint8) error {
+	return pgm.applyTableOrError(levelsTable(inBlack, inWhite, gamma, outBlack, outWhite, pgm.max))
+}
+
+// Levels adjusts every channel of the PPM image. See PGM.Levels.
+func (ppm *PPM) Levels(inBlack, inWhite uint8, gamma float64, outBlack, outWhite uint8) error {
+	return ppm.applyTableOrError(levelsTable(inBlack, inWhite, gamma, outBlack, outWhite, ppm.max))
+}
+
+// Curves maps the gray levels of the PGM image through the curve passing by
+// the control points, where X is the input level and Y the output level. The
+// curve is piecewise linear, or a smooth natural cubic spline when spline is
+// set, and is flat beyond the first and last points.
+func (pgm *PGM) Curves(points []Point, spline bool) error {
+	return pgm.applyTableOrError(curveTable(points, spline, pgm.max))
+}
+
+// Curves maps every channel of the PPM image through the curve. See PGM.Curves.
+func (ppm *PPM) Curves(points []Point, spline bool) error {
+	return ppm.applyTableOrError(curveTable(points, spline, ppm.max))
+}
+
+// Posterize reduces the PGM image to the given number of evenly spaced gray
+// levels, keeping its max value.
+func (pgm *PGM) Posterize(levels int) error {
+	return pgm.applyTableOrError(posterizeTable(levels, pgm.max))
+}
+
+// Posterize reduces every channel of the PPM image to the given number of levels.
+func (ppm *PPM) Posterize(levels int) error {
+	return ppm.applyTableOrError(posterizeTable(levels, ppm.max))
+}
@@ -0,0 +1,260 @@
+package Netpbm
+
+import (
+	"math"
+	"sort"
+)
+
+// SkewMethod selects how the skew of a page is estimated.
+type SkewMethod int
+
+const (
+	// SkewProjection picks the angle whose projection profile has the most
+	// pronounced peaks and valleys.
+	SkewProjection SkewMethod = iota
+	// SkewHough picks the angle of the strongest line in a Hough transform.
+	SkewHough
+)
+
+// LayoutOptions controls the segmentation of a page into text lines.
+type LayoutOptions struct {
+	// HorizontalThreshold and VerticalThreshold are the longest white runs
+	// filled by the run-length smoothing that groups characters into blocks.
+	HorizontalThreshold, VerticalThreshold int
+	// MinLineGap is the number of empty rows needed to separate two lines of a block.
+	MinLineGap int
+}
+
+// HorizontalProjection returns the number of black pixels of every row of the PBM image.
+func (pbm *PBM) HorizontalProjection() []int {
+	profile := make([]int, pbm.height)
+	for y, row := range pbm.data {
+		for _, v := range row {
+			if v {
+				profile[y]++
+			}
+		}
+	}
+	return profile
+}
+
+// VerticalProjection returns the number of black pixels of every column of the PBM image.
+func (pbm *PBM) VerticalProjection() []int {
+	profile := make([]int, pbm.width)
+	for _, row := range pbm.data {
+		for x, v := range row {
+			if v {
+				profile[x]++
+			}
+		}
+	}
+	return profile
+}
+
+// smoothRuns makes black the white runs of at most threshold pixels lying
+// between two black pixels of a line of n pixels.
+func smoothRuns(n, threshold int, get func(i int) bool, set func(i int)) {
+	last := -1
+	for i := 0; i < n; i++ {
+		if !get(i) {
+			continue
+		}
+		if last >= 0 && i-last-1 > 0 && i-last-1 <= threshold {
+			for j := last + 1; j < i; j++ {
+				set(j)
+			}
+		}
+		last = i
+	}
+}
+
+// RLSA applies the run-length smoothing algorithm to the PBM image: white runs
+// up to hThreshold pixels are filled along the rows, white runs up to
+// vThreshold pixels are filled along the columns, the intersection of both is
+// kept and is smoothed again along the rows with a tenth of hThreshold, as in
+// the original algorithm of Wong, Casey and Wahl. Characters merge into blocks
+// of text.
+func (pbm *PBM) RLSA(hThreshold, vThreshold int) *PBM {
+	horizontal := newPBM(pbm.width, pbm.height, pbm.magicNumber)
+	vertical := newPBM(pbm.width, pbm.height, pbm.magicNumber)
+	for y := 0; y < pbm.height; y++ {
+		copy(horizontal.data[y], pbm.data[y])
+		copy(vertical.data[y], pbm.data[y])
+	}
+
+	for y := 0; y < pbm.height; y++ {
+		row := horizontal.data[y]
+		smoothRuns(pbm.width, hThreshold, func(i int) bool { return pbm.data[y][i] }, func(i int) { row[i] = true })
+	}
+	for x := 0; x < pbm.width; x++ {
+		smoothRuns(pbm.height, vThreshold, func(i int) bool { return pbm.data[i][x] }, func(i int) { vertical.data[i][x] = true })
+	}
+
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			horizontal.data[y][x] = horizontal.data[y][x] && vertical.data[y][x]
+		}
+	}
+
+	// A last, shorter horizontal smoothing closes the gaps left by the intersection
+	for y := 0; y < pbm.height; y++ {
+		row := horizontal.data[y]
+		smoothRuns(pbm.width, hThreshold/10, func(i int) bool { return row[i] }, func(i int) { row[i] = true })
+	}
+	return horizontal
+}
+
+// Blocks returns the bounding boxes of the blocks of the PBM image found by
+// run-length smoothing, from top to bottom and left to right.
+func (pbm *PBM) Blocks(hThreshold, vThreshold int) []Rectangle {
+	_, components := pbm.RLSA(hThreshold, vThreshold).ConnectedComponents(Connectivity8)
+	blocks := make([]Rectangle, len(components))
+	for i, c := range components {
+		blocks[i] = c.Bounds
+	}
+	sortRectangles(blocks)
+	return blocks
+}
+
+// sortRectangles orders rectangles from top to bottom and left to right.
+func sortRectangles(r []Rectangle) {
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Min.Y != r[j].Min.Y {
+			return r[i].Min.Y < r[j].Min.Y
+		}
+		return r[i].Min.X < r[j].Min.X
+	})
+}
+
+// Columns splits the PBM image into columns separated by at least minGap
+// empty columns of pixels and returns their bounding boxes from left to right.
+func (pbm *PBM) Columns(minGap int) []Rectangle {
+	profile := pbm.VerticalProjection()
+	var columns []Rectangle
+	for _, band := range bands(profile, minGap) {
+		r := Rectangle{Min: Point{X: band[0], Y: pbm.height}, Max: Point{X: band[1], Y: 0}}
+		for y := 0; y < pbm.height; y++ {
+			for x := band[0]; x < band[1]; x++ {
+				if pbm.data[y][x] {
+					if y < r.Min.Y {
+						r.Min.Y = y
+					}
+					r.Max.Y = y + 1
+					break
+				}
+			}
+		}
+		columns = append(columns, r)
+	}
+	return columns
+}
+
+// bands returns the ranges [start, end) of non-zero values of a profile,
+// merging the ranges separated by fewer than minGap zeros.
+func bands(profile []int, minGap int) [][2]int {
+	var result [][2]int
+	for i := 0; i < len(profile); i++ {
+		if profile[i] == 0 {
+			continue
+		}
+		start := i
+		for i < len(profile) && profile[i] != 0 {
+			i++
+		}
+		if n := len(result); n > 0 && start-result[n-1][1] < minGap {
+			result[n-1][1] = i
+		} else {
+			result = append(result, [2]int{start, i})
+		}
+	}
+	return result
+}
+
+// TextLines segments the PBM image into text lines and returns their bounding
+// boxes, from top to bottom and left to right. The page is first split into
+// blocks by run-length smoothing, then every block is split into lines by its
+// horizontal projection profile, so lines of different columns are kept apart.
+func (pbm *PBM) TextLines(opts LayoutOptions) []Rectangle {
+	var lines []Rectangle
+	for _, block := range pbm.Blocks(opts.HorizontalThreshold, opts.VerticalThreshold) {
+		profile := make([]int, block.Dy())
+		for y := block.Min.Y; y < block.Max.Y; y++ {
+			for x := block.Min.X; x < block.Max.X; x++ {
+				if pbm.data[y][x] {
+					profile[y-block.Min.Y]++
+				}
+			}
+		}
+
+		for _, band := range bands(profile, opts.MinLineGap) {
+			r := Rectangle{Min: Point{X: block.Max.X, Y: block.Min.Y + band[0]}, Max: Point{X: block.Min.X, Y: block.Min.Y + band[1]}}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					if pbm.data[y][x] {
+						if x < r.Min.X {
+							r.Min.X = x
+						}
+						if x+1 > r.Max.X {
+							r.Max.X = x + 1
+						}
+					}
+				}
+			}
+			lines = append(lines, r)
+		}
+	}
+	sortRectangles(lines)
+	return lines
+}
+
+// EstimateSkew estimates the angle in degrees of the text lines of the PBM
+// image, trying every angle from -maxAngle to maxAngle in increments of step.
+// A positive angle means the lines go down from left to right; rotating the
+// page by the opposite angle straightens it.
+func (pbm *PBM) EstimateSkew(method SkewMethod, maxAngle, step float64) float64 {
+	if step <= 0 {
+		step = 0.1
+	}
+
+	// Only the bottom pixels of the black regions are used: they line up on the baselines
+	var points []Point
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if pbm.data[y][x] && (y == pbm.height-1 || !pbm.data[y+1][x]) {
+				points = append(points, Point{X: x, Y: y})
+			}
+		}
+	}
+	if len(points) == 0 {
+		return 0
+	}
+
+	offset := float64(pbm.width + pbm.height)
+	bins := make([]int, 2*(pbm.width+pbm.height)+2)
+	best, bestScore := 0.0, -1.0
+	for angle := -maxAngle; angle <= maxAngle+step/2; angle += step {
+		theta := angle * math.Pi / 180
+		sin, cos := math.Sin(theta), math.Cos(theta)
+		for i := range bins {
+			bins[i] = 0
+		}
+		// Distance of each point to the line through the origin at this angle
+		for _, p := range points {
+			rho := float64(p.Y)*cos - float64(p.X)*sin
+			bins[int(math.Floor(rho+offset+0.5))]++
+		}
+
+		score := 0.0
+		for _, n := range bins {
+			if method == SkewHough {
+				score = math.Max(score, float64(n))
+			} else {
+				score += float64(n) * float64(n)
+			}
+		}
+		if score > bestScore || (score == bestScore && math.Abs(angle) < math.Abs(best)) {
+			best, bestScore = angle, score
+		}
+	}
+	return best
+}
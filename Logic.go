@@ -0,0 +1,109 @@
+package Netpbm
+
+import "math/bits"
+
+// placeRow ORs into dst the packed row src moved dx pixels to the right.
+// Bits falling outside dst are dropped.
+func placeRow(dst, src []uint64, dx int) {
+	n := len(dst)
+	if dx >= 0 {
+		q, r := dx>>6, uint(dx&63)
+		for i, w := range src {
+			if j := i + q; j < n {
+				dst[j] |= w << r
+				if r > 0 && j+1 < n {
+					dst[j+1] |= w >> (64 - r)
+				}
+			}
+		}
+	} else {
+		q, r := (-dx)>>6, uint((-dx)&63)
+		for i, w := range src {
+			if j := i - q; j >= 0 && j < n {
+				dst[j] |= w >> r
+			}
+			if j := i - q - 1; r > 0 && j >= 0 && j < n {
+				dst[j] |= w << (64 - r)
+			}
+		}
+	}
+}
+
+// place returns a bitmap the size of the image holding other with its
+// top-left corner at `at`; the rest of the bitmap is white.
+func (pbm *PBM) place(other *PBM, at Point) *bitmap {
+	b := packPBM(other)
+	placed := newBitmap(pbm.width, pbm.height)
+	mask := placed.lastMask()
+	for y := 0; y < pbm.height; y++ {
+		sy := y - at.Y
+		if sy < 0 || sy >= other.height {
+			continue
+		}
+		row := placed.words[y]
+		placeRow(row, b.words[sy], at.X)
+		if len(row) > 0 {
+			row[len(row)-1] &= mask
+		}
+	}
+	return placed
+}
+
+// combine returns op applied word by word to the packed image and to other
+// placed at `at`.
+func (pbm *PBM) combine(other *PBM, at Point, op func(a, b uint64) uint64) *bitmap {
+	a := packPBM(pbm)
+	b := pbm.place(other, at)
+	mask := a.lastMask()
+	for y := 0; y < a.height; y++ {
+		row := a.words[y]
+		for i := range row {
+			row[i] = op(row[i], b.words[y][i])
+		}
+		if len(row) > 0 {
+			row[len(row)-1] &= mask
+		}
+	}
+	return a
+}
+
+// And keeps the pixels of the PBM image that are black in both the image and
+// other, placed with its top-left corner at `at`. Pixels not covered by other
+// count as white.
+func (pbm *PBM) And(other *PBM, at Point) {
+	pbm.combine(other, at, func(a, b uint64) uint64 { return a & b }).unpack(pbm.data)
+}
+
+// Or makes black the pixels of the PBM image that are black in the image or
+// in other, placed with its top-left corner at `at`.
+func (pbm *PBM) Or(other *PBM, at Point) {
+	pbm.combine(other, at, func(a, b uint64) uint64 { return a | b }).unpack(pbm.data)
+}
+
+// Xor makes black the pixels of the PBM image that are black in exactly one
+// of the image and other, placed with its top-left corner at `at`.
+func (pbm *PBM) Xor(other *PBM, at Point) {
+	pbm.combine(other, at, func(a, b uint64) uint64 { return a ^ b }).unpack(pbm.data)
+}
+
+// AndNot keeps the pixels of the PBM image that are black in the image and
+// white in other, placed with its top-left corner at `at`.
+func (pbm *PBM) AndNot(other *PBM, at Point) {
+	pbm.combine(other, at, func(a, b uint64) uint64 { return a &^ b }).unpack(pbm.data)
+}
+
+// Diff compares the PBM image with other, placed with its top-left corner at
+// `at`, and returns a PBM image of the size of the image where the differing
+// pixels are black, along with the number of differing pixels.
+func (pbm *PBM) Diff(other *PBM, at Point) (*PBM, int) {
+	b := pbm.combine(other, at, func(a, b uint64) uint64 { return a ^ b })
+	count := 0
+	for _, row := range b.words {
+		for _, w := range row {
+			count += bits.OnesCount64(w)
+		}
+	}
+	diff := newPBM(pbm.width, pbm.height, pbm.magicNumber)
+	b.unpack(diff.data)
+	return diff, count
+}
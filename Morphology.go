@@ -0,0 +1,180 @@
+package Netpbm
+
+import "fmt"
+
+// StructuringElement is the probe shape used by morphological operations.
+// Its black pixels are the members of the shape and origin is the pixel that
+// is aligned with the image pixel being computed.
+type StructuringElement struct {
+	data          [][]bool
+	width, height int
+	origin        Point
+}
+
+// NewStructuringElement builds a structuring element from the black pixels of a PBM image.
+func NewStructuringElement(pbm *PBM, origin Point) (*StructuringElement, error) {
+	if origin.X < 0 || origin.Y < 0 || origin.X >= pbm.width || origin.Y >= pbm.height {
+		return nil, fmt.Errorf("origin %v is outside the %d x %d element", origin, pbm.width, pbm.height)
+	}
+	se := &StructuringElement{data: make([][]bool, pbm.height), width: pbm.width, height: pbm.height, origin: origin}
+	for y := range se.data {
+		se.data[y] = make([]bool, pbm.width)
+		copy(se.data[y], pbm.data[y])
+	}
+	return se, nil
+}
+
+// newElement returns a size x size structuring element centered on its middle
+// pixel, with the pixels selected by member.
+func newElement(size int, member func(dx, dy int) bool) *StructuringElement {
+	if size < 1 {
+		size = 1
+	}
+	c := size / 2
+	se := &StructuringElement{data: make([][]bool, size), width: size, height: size, origin: Point{X: c, Y: c}}
+	for y := range se.data {
+		se.data[y] = make([]bool, size)
+		for x := range se.data[y] {
+			se.data[y][x] = member(x-c, y-c)
+		}
+	}
+	return se
+}
+
+// SquareElement returns a size x size square structuring element.
+func SquareElement(size int) *StructuringElement {
+	return newElement(size, func(dx, dy int) bool { return true })
+}
+
+// CrossElement returns a size x size cross-shaped structuring element.
+func CrossElement(size int) *StructuringElement {
+	return newElement(size, func(dx, dy int) bool { return dx == 0 || dy == 0 })
+}
+
+// DiskElement returns a disk-shaped structuring element of the given radius.
+func DiskElement(radius int) *StructuringElement {
+	return newElement(2*radius+1, func(dx, dy int) bool { return dx*dx+dy*dy <= radius*radius })
+}
+
+// offsets returns the positions of the members relative to the origin.
+func (se *StructuringElement) offsets() []Point {
+	var points []Point
+	for y := 0; y < se.height; y++ {
+		for x := 0; x < se.width; x++ {
+			if se.data[y][x] {
+				points = append(points, Point{X: x - se.origin.X, Y: y - se.origin.Y})
+			}
+		}
+	}
+	return points
+}
+
+// dilate returns the dilation of b by se: a pixel is set when the element
+// placed on it, reflected, hits a set pixel. Pixels outside b are clear.
+func dilate(b *bitmap, se *StructuringElement) *bitmap {
+	result := newBitmap(b.width, b.height)
+	shifted := make([]uint64, b.stride)
+	for _, o := range se.offsets() {
+		for y := 0; y < b.height; y++ {
+			sy := y - o.Y
+			if sy < 0 || sy >= b.height {
+				continue
+			}
+			b.shiftRow(shifted, b.words[sy], o.X, false)
+			row := result.words[y]
+			for i, w := range shifted {
+				row[i] |= w
+			}
+		}
+	}
+	return result
+}
+
+// erode returns the erosion of b by se: a pixel is kept when the element
+// placed on it fits entirely inside the set pixels. border is the value
+// assumed for pixels outside b.
+func erode(b *bitmap, se *StructuringElement, border bool) *bitmap {
+	result := newBitmap(b.width, b.height)
+	for y := range result.words {
+		result.fillRow(result.words[y], true)
+	}
+	shifted := make([]uint64, b.stride)
+	for _, o := range se.offsets() {
+		for y := 0; y < b.height; y++ {
+			sy := y + o.Y
+			if sy < 0 || sy >= b.height {
+				if !border {
+					result.fillRow(result.words[y], false)
+				}
+				continue
+			}
+			b.shiftRow(shifted, b.words[sy], -o.X, border)
+			row := result.words[y]
+			for i, w := range shifted {
+				row[i] &= w
+			}
+		}
+	}
+	return result
+}
+
+// andNot returns the pixels set in a and clear in b.
+func andNot(a, b *bitmap) *bitmap {
+	result := newBitmap(a.width, a.height)
+	for y := 0; y < a.height; y++ {
+		for i := range result.words[y] {
+			result.words[y][i] = a.words[y][i] &^ b.words[y][i]
+		}
+	}
+	return result
+}
+
+// Erode erodes the black regions of the PBM image with the structuring element.
+// Pixels outside the image count as white.
+func (pbm *PBM) Erode(se *StructuringElement) {
+	erode(packPBM(pbm), se, false).unpack(pbm.data)
+}
+
+// Dilate dilates the black regions of the PBM image with the structuring element.
+func (pbm *PBM) Dilate(se *StructuringElement) {
+	dilate(packPBM(pbm), se).unpack(pbm.data)
+}
+
+// Open erodes then dilates the PBM image, removing black details smaller than the element.
+func (pbm *PBM) Open(se *StructuringElement) {
+	dilate(erode(packPBM(pbm), se, false), se).unpack(pbm.data)
+}
+
+// Close dilates then erodes the PBM image, filling white gaps smaller than the element.
+func (pbm *PBM) Close(se *StructuringElement) {
+	erode(dilate(packPBM(pbm), se), se, true).unpack(pbm.data)
+}
+
+// HitOrMiss keeps the black pixels where hit fits inside the black pixels and
+// miss fits inside the white pixels of the PBM image. Both elements are
+// aligned on their own origin. Pixels outside the image count as white.
+func (pbm *PBM) HitOrMiss(hit, miss *StructuringElement) {
+	b := packPBM(pbm)
+	fg := erode(b, hit, false)
+	bg := erode(b.not(), miss, true)
+	for y := 0; y < b.height; y++ {
+		for i := range fg.words[y] {
+			fg.words[y][i] &= bg.words[y][i]
+		}
+	}
+	fg.unpack(pbm.data)
+}
+
+// TopHat keeps the black details of the PBM image removed by an opening with
+// the structuring element (white top-hat).
+func (pbm *PBM) TopHat(se *StructuringElement) {
+	b := packPBM(pbm)
+	andNot(b, dilate(erode(b, se, false), se)).unpack(pbm.data)
+}
+
+// BlackTopHat keeps the white gaps of the PBM image filled by a closing with
+// the structuring element.
+func (pbm *PBM) BlackTopHat(se *StructuringElement) {
+	b := packPBM(pbm)
+	andNot(erode(dilate(b, se), se, true), b).unpack(pbm.data)
+}
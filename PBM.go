@@ -14,6 +14,15 @@ type PBM struct {
 	magicNumber   string
 }
 
+// newPBM returns a blank PBM image of the given size.
+func newPBM(width, height int, magicNumber string) *PBM {
+	data := make([][]bool, height)
+	for i := range data {
+		data[i] = make([]bool, width)
+	}
+	return &PBM{data: data, width: width, height: height, magicNumber: magicNumber}
+}
+
 // ReadPGM reads a PGM image from a file and returns a struct that represents the image.
 func ReadPBM(filename string) (*PBM, error) {
 	pbm := PBM{}
@@ -218,3 +227,90 @@ func (pbm *PBM) SetMagicNumber(magicNumber string) {
 	pbm.magicNumber = magicNumber
 
 }
+
+// ToPGM converts the PBM image to PGM, using foreground for black pixels and
+// background for white pixels. The max value of the result is the larger of
+// the two values, or 1 if both are 0.
+func (pbm *PBM) ToPGM(foreground, background uint8) *PGM {
+	max := foreground
+	if background > max {
+		max = background
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	// Create a new PGM image with the same dimensions
+	pgm := newPGM(pbm.width, pbm.height, max, "P2")
+
+	// Map each bit to its gray level
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if pbm.data[y][x] {
+				pgm.data[y][x] = foreground
+			} else {
+				pgm.data[y][x] = background
+			}
+		}
+	}
+
+	return pgm
+}
+
+// ToPPM converts the PBM image to PPM, using foreground for black pixels and
+// background for white pixels. The max value of the result is the largest
+// component of the two colors, or 1 if they are both black.
+func (pbm *PBM) ToPPM(foreground, background Pixel) *PPM {
+	var max uint8 = 1
+	for _, v := range []uint8{foreground.R, foreground.G, foreground.B, background.R, background.G, background.B} {
+		if v > max {
+			max = v
+		}
+	}
+
+	// Create a new PPM image with the same dimensions
+	ppm := newPPM(pbm.width, pbm.height, max, "P3")
+
+	// Map each bit to its color
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if pbm.data[y][x] {
+				ppm.data[y][x] = foreground
+			} else {
+				ppm.data[y][x] = background
+			}
+		}
+	}
+
+	return ppm
+}
+
+// ToPGMSupersampled converts the PBM image to a PGM image n times smaller,
+// where each pixel is the share of white pixels in the matching n x n block
+// scaled to a max value of 255. High-resolution bitmaps are rendered with
+// smooth, anti-aliased edges. Blocks on the right and bottom edges may be
+// smaller than n x n.
+func (pbm *PBM) ToPGMSupersampled(n int) (*PGM, error) {
+	if err := checkFactor(n); err != nil {
+		return nil, err
+	}
+
+	// Count the white bits of every block
+	pgm := newPGM((pbm.width+n-1)/n, (pbm.height+n-1)/n, 255, "P2")
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			white, total := 0, 0
+			for j := y * n; j < y*n+n && j < pbm.height; j++ {
+				for i := x * n; i < x*n+n && i < pbm.width; i++ {
+					if !pbm.data[j][i] {
+						white++
+					}
+					total++
+				}
+			}
+			pgm.data[y][x] = uint8((255*white + total/2) / total)
+		}
+	}
+
+	return pgm, nil
+}
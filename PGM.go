@@ -16,6 +16,15 @@ type PGM struct {
 	max           uint8
 }
 
+// newPGM returns a blank PGM image of the given size.
+func newPGM(width, height int, max uint8, magicNumber string) *PGM {
+	data := make([][]uint8, height)
+	for i := range data {
+		data[i] = make([]uint8, width)
+	}
+	return &PGM{data: data, width: width, height: height, magicNumber: magicNumber, max: max}
+}
+
 // ReadPGM reads a PGM image from a file and returns a struct that represents the image.
 func ReadPGM(filename string) (*PGM, error) {
 	pgm := PGM{}
@@ -19,6 +19,15 @@ type Pixel struct {
 	R, G, B uint8
 }
 
+// newPPM returns a blank PPM image of the given size.
+func newPPM(width, height int, max uint8, magicNumber string) *PPM {
+	data := make([][]Pixel, height)
+	for i := range data {
+		data[i] = make([]Pixel, width)
+	}
+	return &PPM{data: data, width: width, height: height, magicNumber: magicNumber, max: max}
+}
+
 // ReadPPM reads a PPM image from a file and returns a struct that represents the image.
 func ReadPPM(fileName string) (*PPM, error) {
 	// Open the file
@@ -338,3 +347,23 @@ func (ppm *PPM) ToPBM() *PBM {
 type Point struct {
 	X, Y int
 }
+
+// Rectangle is the area between Min (inclusive) and Max (exclusive).
+type Rectangle struct {
+	Min, Max Point
+}
+
+// Dx returns the width of the rectangle.
+func (r Rectangle) Dx() int {
+	return r.Max.X - r.Min.X
+}
+
+// Dy returns the height of the rectangle.
+func (r Rectangle) Dy() int {
+	return r.Max.Y - r.Min.Y
+}
+
+// Empty reports whether the rectangle contains no points.
+func (r Rectangle) Empty() bool {
+	return r.Min.X >= r.Max.X || r.Min.Y >= r.Max.Y
+}
@@ -0,0 +1,276 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// rankFilter replaces every value of data with the value of rank p percent
+// among the (2*radius+1)² values around it, the edge values being repeated.
+// The window histogram slides along the rows and the value of the wanted rank
+// is tracked incrementally, as in the median filter of Huang, so the cost per
+// pixel grows linearly with radius.
+func rankFilter(data [][]uint8, width, height int, max uint8, radius int, p float64) [][]uint8 {
+	out := make([][]uint8, height)
+	for y := range out {
+		out[y] = make([]uint8, width)
+	}
+	if width == 0 || height == 0 {
+		return out
+	}
+	size := 2*radius + 1
+	target := int(math.Round(p / 100 * float64(size*size-1)))
+	counts := make([]int, int(max)+1)
+	level := func(x, y int) int {
+		return clampInt(int(data[clampInt(y, 0, height-1)][clampInt(x, 0, width-1)]), 0, int(max))
+	}
+
+	for y := 0; y < height; y++ {
+		for i := range counts {
+			counts[i] = 0
+		}
+		for j := -radius; j <= radius; j++ {
+			for i := -radius; i <= radius; i++ {
+				counts[level(i, y+j)]++
+			}
+		}
+		// below is the number of values of the window under value
+		value, below := 0, 0
+		for x := 0; x < width; x++ {
+			if x > 0 {
+				for j := -radius; j <= radius; j++ {
+					left, right := level(x-radius-1, y+j), level(x+radius, y+j)
+					counts[left]--
+					counts[right]++
+					if left < value {
+						below--
+					}
+					if right < value {
+						below++
+					}
+				}
+			}
+			for below > target {
+				value--
+				below -= counts[value]
+			}
+			for below+counts[value] <= target {
+				below += counts[value]
+				value++
+			}
+			out[y][x] = uint8(value)
+		}
+	}
+	return out
+}
+
+// morphology returns the minimum (erode) or maximum of data over the
+// structuring element placed on every pixel, reflected for the maximum as in
+// binary dilation. Pixels outside the image are ignored.
+func morphology(data [][]uint8, width, height int, se *StructuringElement, erode bool) [][]uint8 {
+	offsets := se.offsets()
+	out := make([][]uint8, height)
+	for y := 0; y < height; y++ {
+		out[y] = make([]uint8, width)
+		for x := 0; x < width; x++ {
+			result, found := uint8(0), false
+			for _, o := range offsets {
+				sx, sy := x+o.X, y+o.Y
+				if !erode {
+					sx, sy = x-o.X, y-o.Y
+				}
+				if sx < 0 || sx >= width || sy < 0 || sy >= height {
+					continue
+				}
+				v := data[sy][sx]
+				if !found || (erode && v < result) || (!erode && v > result) {
+					result, found = v, true
+				}
+			}
+			if !found {
+				result = data[y][x]
+			}
+			out[y][x] = result
+		}
+	}
+	return out
+}
+
+// morphGradient returns the difference between the dilation and the erosion
+// of data. When the element does not contain its origin the erosion can exceed
+// the dilation; the difference is then 0.
+func morphGradient(data [][]uint8, width, height int, se *StructuringElement) [][]uint8 {
+	dilated := morphology(data, width, height, se, false)
+	eroded := morphology(data, width, height, se, true)
+	for y := range dilated {
+		for x := range dilated[y] {
+			dilated[y][x] = uint8(clampInt(int(dilated[y][x])-int(eroded[y][x]), 0, 255))
+		}
+	}
+	return dilated
+}
+
+// channels returns the red, green and blue channels of the PPM image.
+func (ppm *PPM) channels() [3][][]uint8 {
+	var c [3][][]uint8
+	for i := range c {
+		c[i] = make([][]uint8, ppm.height)
+		for y := range c[i] {
+			c[i][y] = make([]uint8, ppm.width)
+		}
+	}
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			p := ppm.data[y][x]
+			c[0][y][x], c[1][y][x], c[2][y][x] = p.R, p.G, p.B
+		}
+	}
+	return c
+}
+
+// mapChannels replaces every channel of the PPM image with f applied to it.
+func (ppm *PPM) mapChannels(f func(data [][]uint8) [][]uint8) {
+	c := ppm.channels()
+	for i := range c {
+		c[i] = f(c[i])
+	}
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			ppm.data[y][x] = Pixel{R: c[0][y][x], G: c[1][y][x], B: c[2][y][x]}
+		}
+	}
+}
+
+// checkRank returns an error if the radius or the percentile are out of range.
+func checkRank(radius int, p float64) error {
+	if radius < 0 {
+		return fmt.Errorf("invalid radius: %d", radius)
+	}
+	if p < 0 || p > 100 {
+		return fmt.Errorf("invalid percentile: %g", p)
+	}
+	return nil
+}
+
+// PercentileFilter replaces every pixel of the PGM image with the gray level
+// of rank p percent in the square of side 2*radius+1 around it. Pixels
+// outside the image repeat the edge pixels.
+func (pgm *PGM) PercentileFilter(radius int, p float64) error {
+	if err := checkRank(radius, p); err != nil {
+		return err
+	}
+	pgm.data = rankFilter(pgm.data, pgm.width, pgm.height, pgm.max, radius, p)
+	return nil
+}
+
+// PercentileFilter applies the percentile filter to every channel of the PPM
+// image. See PGM.PercentileFilter.
+func (ppm *PPM) PercentileFilter(radius int, p float64) error {
+	if err := checkRank(radius, p); err != nil {
+		return err
+	}
+	ppm.mapChannels(func(data [][]uint8) [][]uint8 {
+		return rankFilter(data, ppm.width, ppm.height, ppm.max, radius, p)
+	})
+	return nil
+}
+
+// MedianFilter replaces every pixel of the PGM image with the median of the
+// square of side 2*radius+1 around it, which removes salt-and-pepper noise
+// while keeping edges sharp.
+func (pgm *PGM) MedianFilter(radius int) error {
+	return pgm.PercentileFilter(radius, 50)
+}
+
+// MedianFilter applies the median filter to every channel of the PPM image.
+func (ppm *PPM) MedianFilter(radius int) error {
+	return ppm.PercentileFilter(radius, 50)
+}
+
+// MinFilter replaces every pixel of the PGM image with the minimum of the
+// square of side 2*radius+1 around it.
+func (pgm *PGM) MinFilter(radius int) error {
+	return pgm.PercentileFilter(radius, 0)
+}
+
+// MinFilter applies the minimum filter to every channel of the PPM image.
+func (ppm *PPM) MinFilter(radius int) error {
+	return ppm.PercentileFilter(radius, 0)
+}
+
+// MaxFilter replaces every pixel of the PGM image with the maximum of the
+// square of side 2*radius+1 around it.
+func (pgm *PGM) MaxFilter(radius int) error {
+	return pgm.PercentileFilter(radius, 100)
+}
+
+// MaxFilter applies the maximum filter to every channel of the PPM image.
+func (ppm *PPM) MaxFilter(radius int) error {
+	return ppm.PercentileFilter(radius, 100)
+}
+
+// Erode replaces every pixel of the PGM image with the minimum of the pixels
+// under the structuring element, darkening the image. Pixels outside the
+// image are ignored.
+func (pgm *PGM) Erode(se *StructuringElement) {
+	pgm.data = morphology(pgm.data, pgm.width, pgm.height, se, true)
+}
+
+// Erode erodes every channel of the PPM image. See PGM.Erode.
+func (ppm *PPM) Erode(se *StructuringElement) {
+	ppm.mapChannels(func(data [][]uint8) [][]uint8 {
+		return morphology(data, ppm.width, ppm.height, se, true)
+	})
+}
+
+// Dilate replaces every pixel of the PGM image with the maximum of the pixels
+// under the reflected structuring element, brightening the image.
+func (pgm *PGM) Dilate(se *StructuringElement) {
+	pgm.data = morphology(pgm.data, pgm.width, pgm.height, se, false)
+}
+
+// Dilate dilates every channel of the PPM image. See PGM.Dilate.
+func (ppm *PPM) Dilate(se *StructuringElement) {
+	ppm.mapChannels(func(data [][]uint8) [][]uint8 {
+		return morphology(data, ppm.width, ppm.height, se, false)
+	})
+}
+
+// Open erodes then dilates the PGM image, removing bright details smaller than the element.
+func (pgm *PGM) Open(se *StructuringElement) {
+	pgm.Erode(se)
+	pgm.Dilate(se)
+}
+
+// Open erodes then dilates every channel of the PPM image.
+func (ppm *PPM) Open(se *StructuringElement) {
+	ppm.Erode(se)
+	ppm.Dilate(se)
+}
+
+// Close dilates then erodes the PGM image, removing dark details smaller than the element.
+func (pgm *PGM) Close(se *StructuringElement) {
+	pgm.Dilate(se)
+	pgm.Erode(se)
+}
+
+// Close dilates then erodes every channel of the PPM image.
+func (ppm *PPM) Close(se *StructuringElement) {
+	ppm.Dilate(se)
+	ppm.Erode(se)
+}
+
+// MorphGradient replaces every pixel of the PGM image with the difference
+// between its dilation and its erosion, which highlights the edges. Elements
+// that do not contain their origin are allowed; where the erosion exceeds the
+// dilation the result is 0.
+func (pgm *PGM) MorphGradient(se *StructuringElement) {
+	pgm.data = morphGradient(pgm.data, pgm.width, pgm.height, se)
+}
+
+// MorphGradient computes the morphological gradient of every channel of the PPM image.
+func (ppm *PPM) MorphGradient(se *StructuringElement) {
+	ppm.mapChannels(func(data [][]uint8) [][]uint8 {
+		return morphGradient(data, ppm.width, ppm.height, se)
+	})
+}
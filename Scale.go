@@ -0,0 +1,308 @@
+package Netpbm
+
+import "fmt"
+
+// enlarge replicates every pixel into an n x n block.
+func enlarge[T any](data [][]T, width, height, n int) [][]T {
+	result := make([][]T, height*n)
+	for y := 0; y < height; y++ {
+		row := make([]T, width*n)
+		for x := 0; x < width; x++ {
+			for i := 0; i < n; i++ {
+				row[x*n+i] = data[y][x]
+			}
+		}
+		result[y*n] = row
+		for i := 1; i < n; i++ {
+			result[y*n+i] = make([]T, width*n)
+			copy(result[y*n+i], row)
+		}
+	}
+	return result
+}
+
+// neighbors returns the 3x3 neighborhood of (x, y), repeating the edge pixels.
+func neighbors[T any](data [][]T, width, height, x, y int) (a, b, c, d, e, f, g, h, i T) {
+	xl, xr := clampInt(x-1, 0, width-1), clampInt(x+1, 0, width-1)
+	yu, yd := clampInt(y-1, 0, height-1), clampInt(y+1, 0, height-1)
+	return data[yu][xl], data[yu][x], data[yu][xr],
+		data[y][xl], data[y][x], data[y][xr],
+		data[yd][xl], data[yd][x], data[yd][xr]
+}
+
+// scale2x doubles the image with the Scale2x (AdvMAME2x) algorithm.
+func scale2x[T comparable](data [][]T, width, height int) [][]T {
+	result := make([][]T, height*2)
+	for y := range result {
+		result[y] = make([]T, width*2)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			_, a, _, c, p, b, _, d, _ := neighbors(data, width, height, x, y)
+			e0, e1, e2, e3 := p, p, p, p
+			if c == a && c != d && a != b {
+				e0 = a
+			}
+			if a == b && a != c && b != d {
+				e1 = b
+			}
+			if d == c && d != b && c != a {
+				e2 = c
+			}
+			if b == d && b != a && d != c {
+				e3 = d
+			}
+			result[2*y][2*x], result[2*y][2*x+1] = e0, e1
+			result[2*y+1][2*x], result[2*y+1][2*x+1] = e2, e3
+		}
+	}
+	return result
+}
+
+// epx doubles the image with the original EPX algorithm, which keeps the
+// center pixel wherever three or more of its neighbors are identical.
+func epx[T comparable](data [][]T, width, height int) [][]T {
+	result := make([][]T, height*2)
+	for y := range result {
+		result[y] = make([]T, width*2)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			_, a, _, c, p, b, _, d, _ := neighbors(data, width, height, x, y)
+			e0, e1, e2, e3 := p, p, p, p
+			if c == a {
+				e0 = a
+			}
+			if a == b {
+				e1 = b
+			}
+			if d == c {
+				e2 = c
+			}
+			if b == d {
+				e3 = d
+			}
+			if (a == b && (a == c || a == d)) || (c == d && (c == a || c == b)) {
+				e0, e1, e2, e3 = p, p, p, p
+			}
+			result[2*y][2*x], result[2*y][2*x+1] = e0, e1
+			result[2*y+1][2*x], result[2*y+1][2*x+1] = e2, e3
+		}
+	}
+	return result
+}
+
+// scale3x triples the image with the Scale3x (AdvMAME3x) algorithm.
+func scale3x[T comparable](data [][]T, width, height int) [][]T {
+	result := make([][]T, height*3)
+	for y := range result {
+		result[y] = make([]T, width*3)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a, b, c, d, e, f, g, h, i := neighbors(data, width, height, x, y)
+			var out [9]T
+			for k := range out {
+				out[k] = e
+			}
+			if d == b && b != f && d != h {
+				out[0] = d
+			}
+			if (d == b && b != f && d != h && e != c) || (b == f && b != d && f != h && e != a) {
+				out[1] = b
+			}
+			if b == f && b != d && f != h {
+				out[2] = f
+			}
+			if (d == b && b != f && d != h && e != g) || (d == h && d != b && h != f && e != a) {
+				out[3] = d
+			}
+			if (b == f && b != d && f != h && e != i) || (h == f && d != h && b != f && e != c) {
+				out[5] = f
+			}
+			if d == h && d != b && h != f {
+				out[6] = d
+			}
+			if (d == h && d != b && h != f && e != i) || (h == f && d != h && b != f && e != g) {
+				out[7] = h
+			}
+			if h == f && d != h && b != f {
+				out[8] = f
+			}
+			for k := 0; k < 9; k++ {
+				result[3*y+k/3][3*x+k%3] = out[k]
+			}
+		}
+	}
+	return result
+}
+
+// reduce shrinks the image by n, combining every n x n block with merge.
+// Blocks on the right and bottom edges may be smaller than n x n.
+func reduce[T any](data [][]T, width, height, n int, merge func(block []T) T) [][]T {
+	newWidth, newHeight := (width+n-1)/n, (height+n-1)/n
+	result := make([][]T, newHeight)
+	block := make([]T, 0, n*n)
+	for y := 0; y < newHeight; y++ {
+		result[y] = make([]T, newWidth)
+		for x := 0; x < newWidth; x++ {
+			block = block[:0]
+			for j := y * n; j < y*n+n && j < height; j++ {
+				for i := x * n; i < x*n+n && i < width; i++ {
+					block = append(block, data[j][i])
+				}
+			}
+			result[y][x] = merge(block)
+		}
+	}
+	return result
+}
+
+// checkFactor verifies that a scaling factor is usable.
+func checkFactor(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid scale factor: %d", n)
+	}
+	return nil
+}
+
+// Enlarge enlarges the PBM image n times by pixel replication, like pamenlarge.
+func (pbm *PBM) Enlarge(n int) error {
+	if err := checkFactor(n); err != nil {
+		return err
+	}
+	pbm.data = enlarge(pbm.data, pbm.width, pbm.height, n)
+	pbm.width, pbm.height = pbm.width*n, pbm.height*n
+	return nil
+}
+
+// Enlarge enlarges the PGM image n times by pixel replication, like pamenlarge.
+func (pgm *PGM) Enlarge(n int) error {
+	if err := checkFactor(n); err != nil {
+		return err
+	}
+	pgm.data = enlarge(pgm.data, pgm.width, pgm.height, n)
+	pgm.width, pgm.height = pgm.width*n, pgm.height*n
+	return nil
+}
+
+// Enlarge enlarges the PPM image n times by pixel replication, like pamenlarge.
+func (ppm *PPM) Enlarge(n int) error {
+	if err := checkFactor(n); err != nil {
+		return err
+	}
+	ppm.data = enlarge(ppm.data, ppm.width, ppm.height, n)
+	ppm.width, ppm.height = ppm.width*n, ppm.height*n
+	return nil
+}
+
+// Reduce shrinks the PBM image n times. A pixel of the result is black when
+// at least half of the pixels of its n x n block are black.
+func (pbm *PBM) Reduce(n int) error {
+	if err := checkFactor(n); err != nil {
+		return err
+	}
+	pbm.data = reduce(pbm.data, pbm.width, pbm.height, n, func(block []bool) bool {
+		black := 0
+		for _, v := range block {
+			if v {
+				black++
+			}
+		}
+		return 2*black >= len(block)
+	})
+	pbm.width, pbm.height = (pbm.width+n-1)/n, (pbm.height+n-1)/n
+	return nil
+}
+
+// Reduce shrinks the PGM image n times, averaging every n x n block.
+func (pgm *PGM) Reduce(n int) error {
+	if err := checkFactor(n); err != nil {
+		return err
+	}
+	pgm.data = reduce(pgm.data, pgm.width, pgm.height, n, func(block []uint8) uint8 {
+		sum := 0
+		for _, v := range block {
+			sum += int(v)
+		}
+		return uint8((sum + len(block)/2) / len(block))
+	})
+	pgm.width, pgm.height = (pgm.width+n-1)/n, (pgm.height+n-1)/n
+	return nil
+}
+
+// Reduce shrinks the PPM image n times, averaging every n x n block.
+func (ppm *PPM) Reduce(n int) error {
+	if err := checkFactor(n); err != nil {
+		return err
+	}
+	ppm.data = reduce(ppm.data, ppm.width, ppm.height, n, func(block []Pixel) Pixel {
+		var r, g, b int
+		for _, p := range block {
+			r += int(p.R)
+			g += int(p.G)
+			b += int(p.B)
+		}
+		half := len(block) / 2
+		return Pixel{R: uint8((r + half) / len(block)), G: uint8((g + half) / len(block)), B: uint8((b + half) / len(block))}
+	})
+	ppm.width, ppm.height = (ppm.width+n-1)/n, (ppm.height+n-1)/n
+	return nil
+}
+
+// Scale2x doubles the size of the PBM image with the Scale2x algorithm,
+// which smooths diagonal edges without introducing new colors.
+func (pbm *PBM) Scale2x() {
+	pbm.data = scale2x(pbm.data, pbm.width, pbm.height)
+	pbm.width, pbm.height = pbm.width*2, pbm.height*2
+}
+
+// Scale2x doubles the size of the PGM image with the Scale2x algorithm,
+// which smooths diagonal edges without introducing new colors.
+func (pgm *PGM) Scale2x() {
+	pgm.data = scale2x(pgm.data, pgm.width, pgm.height)
+	pgm.width, pgm.height = pgm.width*2, pgm.height*2
+}
+
+// Scale2x doubles the size of the PPM image with the Scale2x algorithm,
+// which smooths diagonal edges without introducing new colors.
+func (ppm *PPM) Scale2x() {
+	ppm.data = scale2x(ppm.data, ppm.width, ppm.height)
+	ppm.width, ppm.height = ppm.width*2, ppm.height*2
+}
+
+// Scale3x triples the size of the PBM image with the Scale3x algorithm.
+func (pbm *PBM) Scale3x() {
+	pbm.data = scale3x(pbm.data, pbm.width, pbm.height)
+	pbm.width, pbm.height = pbm.width*3, pbm.height*3
+}
+
+// Scale3x triples the size of the PGM image with the Scale3x algorithm.
+func (pgm *PGM) Scale3x() {
+	pgm.data = scale3x(pgm.data, pgm.width, pgm.height)
+	pgm.width, pgm.height = pgm.width*3, pgm.height*3
+}
+
+// Scale3x triples the size of the PPM image with the Scale3x algorithm.
+func (ppm *PPM) Scale3x() {
+	ppm.data = scale3x(ppm.data, ppm.width, ppm.height)
+	ppm.width, ppm.height = ppm.width*3, ppm.height*3
+}
+
+// EPX doubles the size of the PBM image with the original EPX algorithm.
+func (pbm *PBM) EPX() {
+	pbm.data = epx(pbm.data, pbm.width, pbm.height)
+	pbm.width, pbm.height = pbm.width*2, pbm.height*2
+}
+
+// EPX doubles the size of the PGM image with the original EPX algorithm.
+func (pgm *PGM) EPX() {
+	pgm.data = epx(pgm.data, pgm.width, pgm.height)
+	pgm.width, pgm.height = pgm.width*2, pgm.height*2
+}
+
+// EPX doubles the size of the PPM image with the original EPX algorithm.
+func (ppm *PPM) EPX() {
+	ppm.data = epx(ppm.data, ppm.width, ppm.height)
+	ppm.width, ppm.height = ppm.width*2, ppm.height*2
+}
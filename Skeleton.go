@@ -0,0 +1,230 @@
+package Netpbm
+
+import "math"
+
+// DistanceMetric selects how distances between pixels are measured.
+type DistanceMetric int
+
+const (
+	// DistanceEuclidean is the straight-line distance.
+	DistanceEuclidean DistanceMetric = iota
+	// DistanceChessboard counts diagonal steps as 1 (L∞ distance).
+	DistanceChessboard
+	// DistanceCityBlock counts only horizontal and vertical steps (L1 distance).
+	DistanceCityBlock
+)
+
+// DistanceTransform returns, for every black pixel of the PBM image, the
+// distance to the nearest white pixel; white pixels get 0. The border of the
+// image is not considered white, so an image without white pixels is at
+// infinite distance everywhere.
+func (pbm *PBM) DistanceTransform(metric DistanceMetric) [][]float64 {
+	dist := make([][]float64, pbm.height)
+	for y := range dist {
+		dist[y] = make([]float64, pbm.width)
+	}
+
+	if metric == DistanceEuclidean {
+		euclideanDistance(pbm, dist)
+		return dist
+	}
+
+	// Two-pass chamfer transform, exact for the L1 and L∞ metrics
+	inf := math.Inf(1)
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if pbm.data[y][x] {
+				dist[y][x] = inf
+			}
+		}
+	}
+	diagonal := metric == DistanceChessboard
+	relax := func(y, x, ny, nx int) {
+		if ny >= 0 && ny < pbm.height && nx >= 0 && nx < pbm.width && dist[ny][nx]+1 < dist[y][x] {
+			dist[y][x] = dist[ny][nx] + 1
+		}
+	}
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			relax(y, x, y-1, x)
+			relax(y, x, y, x-1)
+			if diagonal {
+				relax(y, x, y-1, x-1)
+				relax(y, x, y-1, x+1)
+			}
+		}
+	}
+	for y := pbm.height - 1; y >= 0; y-- {
+		for x := pbm.width - 1; x >= 0; x-- {
+			relax(y, x, y+1, x)
+			relax(y, x, y, x+1)
+			if diagonal {
+				relax(y, x, y+1, x+1)
+				relax(y, x, y+1, x-1)
+			}
+		}
+	}
+	return dist
+}
+
+// euclideanDistance computes the exact Euclidean distance transform with the
+// separable algorithm of Felzenszwalb and Huttenlocher.
+func euclideanDistance(pbm *PBM, dist [][]float64) {
+	const inf = 1e20
+	n := pbm.width
+	if pbm.height > n {
+		n = pbm.height
+	}
+	f := make([]float64, n)
+	d := make([]float64, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+
+	// Squared distances along the columns, then along the rows
+	for x := 0; x < pbm.width; x++ {
+		for y := 0; y < pbm.height; y++ {
+			f[y] = 0
+			if pbm.data[y][x] {
+				f[y] = inf
+			}
+		}
+		distance1D(f[:pbm.height], d, v, z)
+		for y := 0; y < pbm.height; y++ {
+			dist[y][x] = d[y]
+		}
+	}
+	for y := 0; y < pbm.height; y++ {
+		copy(f, dist[y])
+		distance1D(f[:pbm.width], d, v, z)
+		for x := 0; x < pbm.width; x++ {
+			if d[x] >= inf/2 {
+				dist[y][x] = math.Inf(1)
+			} else {
+				dist[y][x] = math.Sqrt(d[x])
+			}
+		}
+	}
+}
+
+// distance1D computes the squared distance transform of the sampled function
+// f into d, using v and z as scratch space.
+func distance1D(f, d []float64, v []int, z []float64) {
+	n := len(f)
+	if n == 0 {
+		return
+	}
+	k := 0
+	v[0] = 0
+	z[0], z[1] = math.Inf(-1), math.Inf(1)
+	for q := 1; q < n; q++ {
+		s := ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		for s <= z[k] {
+			k--
+			s = ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		}
+		k++
+		v[k] = q
+		z[k], z[k+1] = s, math.Inf(1)
+	}
+	k = 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		d[q] = float64((q-v[k])*(q-v[k])) + f[v[k]]
+	}
+}
+
+// DistanceMap returns the distance transform of the PBM image as a PGM image.
+// Distances are rounded and limited to 255, and the max value of the result
+// is the largest distance.
+func (pbm *PBM) DistanceMap(metric DistanceMetric) *PGM {
+	dist := pbm.DistanceTransform(metric)
+	pgm := newPGM(pbm.width, pbm.height, 1, "P2")
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			v := clampUint8(dist[y][x], 255)
+			pgm.data[y][x] = v
+			if v > pgm.max {
+				pgm.max = v
+			}
+		}
+	}
+	return pgm
+}
+
+// Thin reduces the black regions of the PBM image to 1-pixel-wide skeletons
+// with the Zhang-Suen thinning algorithm.
+func (pbm *PBM) Thin() {
+	at := func(y, x int) bool {
+		return y >= 0 && y < pbm.height && x >= 0 && x < pbm.width && pbm.data[y][x]
+	}
+
+	var marked []Point
+	for changed := true; changed; {
+		changed = false
+		for step := 0; step < 2; step++ {
+			marked = marked[:0]
+			for y := 0; y < pbm.height; y++ {
+				for x := 0; x < pbm.width; x++ {
+					if !pbm.data[y][x] {
+						continue
+					}
+					// Neighbors P2..P9, clockwise from north
+					p := [8]bool{at(y-1, x), at(y-1, x+1), at(y, x+1), at(y+1, x+1), at(y+1, x), at(y+1, x-1), at(y, x-1), at(y-1, x-1)}
+					black, transitions := 0, 0
+					for i := 0; i < 8; i++ {
+						if p[i] {
+							black++
+						}
+						if !p[i] && p[(i+1)%8] {
+							transitions++
+						}
+					}
+					if black < 2 || black > 6 || transitions != 1 {
+						continue
+					}
+					if step == 0 && (p[0] && p[2] && p[4] || p[2] && p[4] && p[6]) {
+						continue
+					}
+					if step == 1 && (p[0] && p[2] && p[6] || p[0] && p[4] && p[6]) {
+						continue
+					}
+					marked = append(marked, Point{X: x, Y: y})
+				}
+			}
+			for _, m := range marked {
+				pbm.data[m.Y][m.X] = false
+			}
+			if len(marked) > 0 {
+				changed = true
+			}
+		}
+	}
+}
+
+// MedialAxis returns the medial axis of the black regions of the PBM image:
+// the black pixels whose Euclidean distance to the white pixels is not
+// exceeded by any of their 4 neighbors.
+func (pbm *PBM) MedialAxis() *PBM {
+	dist := pbm.DistanceTransform(DistanceEuclidean)
+	axis := newPBM(pbm.width, pbm.height, pbm.magicNumber)
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if !pbm.data[y][x] {
+				continue
+			}
+			d := dist[y][x]
+			ridge := true
+			for _, o := range [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				ny, nx := y+o[0], x+o[1]
+				if ny >= 0 && ny < pbm.height && nx >= 0 && nx < pbm.width && dist[ny][nx] > d {
+					ridge = false
+					break
+				}
+			}
+			axis.data[y][x] = ridge
+		}
+	}
+	return axis
+}
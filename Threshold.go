@@ -0,0 +1,333 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// ThresholdMethod selects how the threshold between black and white is chosen
+// when converting to PBM.
+type ThresholdMethod int
+
+const (
+	// ThresholdFixed uses ThresholdOptions.Value.
+	ThresholdFixed ThresholdMethod = iota
+	// ThresholdOtsu maximizes the variance between the two classes.
+	ThresholdOtsu
+	// ThresholdTriangle uses the level farthest from the line joining the
+	// histogram peak to the end of its longest tail.
+	ThresholdTriangle
+	// ThresholdKapur maximizes the sum of the entropies of the two classes.
+	ThresholdKapur
+	// ThresholdIsodata iterates the threshold to the midpoint of the class means.
+	ThresholdIsodata
+	// ThresholdMean compares each pixel to the mean of its window minus C.
+	ThresholdMean
+	// ThresholdGaussian compares each pixel to the Gaussian-weighted mean of its window minus C.
+	ThresholdGaussian
+	// ThresholdNiblack compares each pixel to mean + K * standard deviation of its window.
+	ThresholdNiblack
+	// ThresholdSauvola compares each pixel to mean * (1 + K * (deviation / R - 1)) of its window.
+	ThresholdSauvola
+)
+
+// ThresholdOptions controls the conversion of a gray image to PBM. The zero
+// value thresholds at half the max value, like ToPBM.
+type ThresholdOptions struct {
+	Method ThresholdMethod
+	// Value is the threshold of ThresholdFixed: levels below it become black.
+	// 0 selects half the max value.
+	Value uint8
+	// Window is the side of the neighborhood of the local methods; 0 selects 15.
+	Window int
+	// K weights the standard deviation; 0 selects -0.2 for Niblack and 0.5 for Sauvola.
+	K float64
+	// C is subtracted from the local mean of ThresholdMean and ThresholdGaussian.
+	C float64
+	// R is the dynamic range of the standard deviation for Sauvola; 0 selects
+	// half the max value.
+	R float64
+}
+
+// Threshold computes a global threshold from the histogram with the given
+// method: levels below the returned value are considered black. Local
+// methods cannot be computed from a histogram and return an error.
+func (h *Histogram) Threshold(method ThresholdMethod) (int, error) {
+	switch method {
+	case ThresholdOtsu:
+		return h.otsu(), nil
+	case ThresholdTriangle:
+		return h.triangle(), nil
+	case ThresholdKapur:
+		return h.kapur(), nil
+	case ThresholdIsodata:
+		return h.isodata(), nil
+	}
+	return 0, fmt.Errorf("threshold method %d is not a global method", method)
+}
+
+// otsu returns the threshold maximizing the between-class variance.
+func (h *Histogram) otsu() int {
+	total, sum := 0.0, 0.0
+	for i, n := range h.Counts {
+		total += float64(n)
+		sum += float64(i) * float64(n)
+	}
+
+	best, bestVariance := 0, -1.0
+	w0, sum0 := 0.0, 0.0
+	for k, n := range h.Counts {
+		w0 += float64(n)
+		sum0 += float64(k) * float64(n)
+		w1 := total - w0
+		if w0 == 0 || w1 == 0 {
+			continue
+		}
+		m0, m1 := sum0/w0, (sum-sum0)/w1
+		if variance := w0 * w1 * (m0 - m1) * (m0 - m1); variance > bestVariance {
+			best, bestVariance = k, variance
+		}
+	}
+	return best + 1
+}
+
+// triangle returns the threshold of the triangle method.
+func (h *Histogram) triangle() int {
+	first, last, peak := -1, -1, 0
+	for i, n := range h.Counts {
+		if n > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+		if n > h.Counts[peak] {
+			peak = i
+		}
+	}
+	if first < 0 || first == last {
+		return first + 1
+	}
+
+	// Follow the longest tail, ending just past the last occupied level
+	end := last + 1
+	if peak-first > last-peak {
+		end = first - 1
+	}
+	count := func(i int) float64 {
+		if i < 0 || i >= len(h.Counts) {
+			return 0
+		}
+		return float64(h.Counts[i])
+	}
+
+	best, bestDist := peak, -1.0
+	step := 1
+	if end < peak {
+		step = -1
+	}
+	hp, he := count(peak), count(end)
+	for i := peak; i != end; i += step {
+		// Unnormalized distance from the histogram to the line peak-end
+		dist := math.Abs((he-hp)*float64(i) - float64(end-peak)*count(i) + float64(end)*hp - he*float64(peak))
+		if dist > bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best + 1
+}
+
+// kapur returns the threshold maximizing the sum of the class entropies.
+func (h *Histogram) kapur() int {
+	total := float64(h.Total())
+	if total == 0 {
+		return 0
+	}
+	cumulative := h.Cumulative()
+
+	best, bestEntropy := 0, math.Inf(-1)
+	for k := 0; k < len(h.Counts)-1; k++ {
+		p0 := float64(cumulative[k]) / total
+		p1 := 1 - p0
+		if p0 <= 0 || p1 <= 0 {
+			continue
+		}
+		entropy := 0.0
+		for i, n := range h.Counts {
+			if n == 0 {
+				continue
+			}
+			p := float64(n) / total
+			if i <= k {
+				entropy -= p / p0 * math.Log(p/p0)
+			} else {
+				entropy -= p / p1 * math.Log(p/p1)
+			}
+		}
+		if entropy > bestEntropy {
+			best, bestEntropy = k, entropy
+		}
+	}
+	return best + 1
+}
+
+// isodata returns the threshold halfway between the means of the two classes it separates.
+func (h *Histogram) isodata() int {
+	stats := h.Stats()
+	t := stats.Mean
+	for i := 0; i < 256; i++ {
+		var n0, s0, n1, s1 float64
+		for v, n := range h.Counts {
+			if float64(v) < t {
+				n0 += float64(n)
+				s0 += float64(v) * float64(n)
+			} else {
+				n1 += float64(n)
+				s1 += float64(v) * float64(n)
+			}
+		}
+		if n0 == 0 || n1 == 0 {
+			break
+		}
+		next := (s0/n0 + s1/n1) / 2
+		if math.Abs(next-t) < 0.5 {
+			t = next
+			break
+		}
+		t = next
+	}
+	return int(math.Ceil(t))
+}
+
+// gaussianKernel returns a normalized 1D Gaussian kernel of the given radius.
+func gaussianKernel(sigma float64, radius int) []float64 {
+	kernel := make([]float64, 2*radius+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// ToPBMThreshold converts the PGM image to PBM with the given threshold strategy.
+func (pgm *PGM) ToPBMThreshold(opts ThresholdOptions) (*PBM, error) {
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+
+	switch opts.Method {
+	case ThresholdFixed, ThresholdOtsu, ThresholdTriangle, ThresholdKapur, ThresholdIsodata:
+		t := int(opts.Value)
+		if t == 0 {
+			t = int(pgm.max / 2)
+		}
+		if opts.Method != ThresholdFixed {
+			t, _ = pgm.Histogram().Threshold(opts.Method)
+		}
+		for y := 0; y < pgm.height; y++ {
+			for x := 0; x < pgm.width; x++ {
+				pbm.data[y][x] = int(pgm.data[y][x]) < t
+			}
+		}
+		return pbm, nil
+	case ThresholdMean, ThresholdGaussian, ThresholdNiblack, ThresholdSauvola:
+	default:
+		return nil, fmt.Errorf("unknown threshold method: %d", opts.Method)
+	}
+
+	window := opts.Window
+	if window == 0 {
+		window = 15
+	}
+	if window < 1 {
+		return nil, fmt.Errorf("invalid window size: %d", window)
+	}
+	radius := window / 2
+
+	// Local thresholds from the mean and standard deviation of each window
+	threshold := make([][]float64, pgm.height)
+	if opts.Method == ThresholdGaussian {
+		sigma := 0.3*(float64(window-1)*0.5-1) + 0.8
+		kernel := gaussianKernel(sigma, radius)
+		horizontal := make([][]float64, pgm.height)
+		for y := 0; y < pgm.height; y++ {
+			horizontal[y] = make([]float64, pgm.width)
+			for x := 0; x < pgm.width; x++ {
+				for k, w := range kernel {
+					horizontal[y][x] += w * float64(pgm.data[y][clampInt(x+k-radius, 0, pgm.width-1)])
+				}
+			}
+		}
+		for y := 0; y < pgm.height; y++ {
+			threshold[y] = make([]float64, pgm.width)
+			for x := 0; x < pgm.width; x++ {
+				for k, w := range kernel {
+					threshold[y][x] += w * horizontal[clampInt(y+k-radius, 0, pgm.height-1)][x]
+				}
+				threshold[y][x] -= opts.C
+			}
+		}
+	} else {
+		// Integral images of the values and of their squares
+		sum := make([][]float64, pgm.height+1)
+		sumSquares := make([][]float64, pgm.height+1)
+		for y := range sum {
+			sum[y] = make([]float64, pgm.width+1)
+			sumSquares[y] = make([]float64, pgm.width+1)
+		}
+		for y := 0; y < pgm.height; y++ {
+			for x := 0; x < pgm.width; x++ {
+				v := float64(pgm.data[y][x])
+				sum[y+1][x+1] = v + sum[y][x+1] + sum[y+1][x] - sum[y][x]
+				sumSquares[y+1][x+1] = v*v + sumSquares[y][x+1] + sumSquares[y+1][x] - sumSquares[y][x]
+			}
+		}
+
+		k, r := opts.K, opts.R
+		if k == 0 {
+			k = -0.2
+			if opts.Method == ThresholdSauvola {
+				k = 0.5
+			}
+		}
+		if r == 0 {
+			r = float64(pgm.max) / 2
+		}
+		for y := 0; y < pgm.height; y++ {
+			threshold[y] = make([]float64, pgm.width)
+			y0, y1 := clampInt(y-radius, 0, pgm.height), clampInt(y+radius+1, 0, pgm.height)
+			for x := 0; x < pgm.width; x++ {
+				x0, x1 := clampInt(x-radius, 0, pgm.width), clampInt(x+radius+1, 0, pgm.width)
+				n := float64((y1 - y0) * (x1 - x0))
+				s := sum[y1][x1] - sum[y0][x1] - sum[y1][x0] + sum[y0][x0]
+				sq := sumSquares[y1][x1] - sumSquares[y0][x1] - sumSquares[y1][x0] + sumSquares[y0][x0]
+				mean := s / n
+				deviation := math.Sqrt(math.Max(0, sq/n-mean*mean))
+				switch opts.Method {
+				case ThresholdMean:
+					threshold[y][x] = mean - opts.C
+				case ThresholdNiblack:
+					threshold[y][x] = mean + k*deviation
+				case ThresholdSauvola:
+					threshold[y][x] = mean * (1 + k*(deviation/r-1))
+				}
+			}
+		}
+	}
+
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			pbm.data[y][x] = float64(pgm.data[y][x]) < threshold[y][x]
+		}
+	}
+	return pbm, nil
+}
+
+// ToPBMThreshold converts the PPM image to PBM with the given threshold
+// strategy, applied to the average of the three channels as in ToPBM.
+func (ppm *PPM) ToPBMThreshold(opts ThresholdOptions) (*PBM, error) {
+	return ppm.ToPGM().ToPBMThreshold(opts)
+}
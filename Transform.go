@@ -0,0 +1,189 @@
+package Netpbm
+
+import "fmt"
+
+// Transform records a sequence of geometric operations and applies them to an
+// image in a single pass. The operations are composed into one coordinate
+// mapping, so the image is traversed and reallocated only once however long
+// the sequence is.
+type Transform struct {
+	ops []transformOp
+}
+
+type transformKind int
+
+const (
+	transformFlip transformKind = iota
+	transformFlop
+	transformRotate90CW
+	transformRotate90CCW
+	transformRotate180
+	transformTranspose
+	transformCrop
+)
+
+type transformOp struct {
+	kind transformKind
+	rect Rectangle
+}
+
+// coordMap maps a destination pixel (x, y) to its source pixel:
+// srcX = ax*x + bx*y + cx and srcY = ay*x + by*y + cy.
+type coordMap struct {
+	ax, bx, cx int
+	ay, by, cy int
+}
+
+// then returns the mapping applying o to destination coordinates before m.
+func (m coordMap) then(o coordMap) coordMap {
+	return coordMap{
+		ax: m.ax*o.ax + m.bx*o.ay,
+		bx: m.ax*o.bx + m.bx*o.by,
+		cx: m.ax*o.cx + m.bx*o.cy + m.cx,
+		ay: m.ay*o.ax + m.by*o.ay,
+		by: m.ay*o.bx + m.by*o.by,
+		cy: m.ay*o.cx + m.by*o.cy + m.cy,
+	}
+}
+
+// NewTransform returns an empty transform.
+func NewTransform() *Transform {
+	return &Transform{}
+}
+
+// Flip mirrors the image horizontally.
+func (t *Transform) Flip() *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformFlip})
+	return t
+}
+
+// Flop mirrors the image vertically.
+func (t *Transform) Flop() *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformFlop})
+	return t
+}
+
+// Rotate90CW rotates the image 90° clockwise.
+func (t *Transform) Rotate90CW() *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformRotate90CW})
+	return t
+}
+
+// Rotate90CCW rotates the image 90° counterclockwise.
+func (t *Transform) Rotate90CCW() *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformRotate90CCW})
+	return t
+}
+
+// Rotate180 rotates the image by 180°.
+func (t *Transform) Rotate180() *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformRotate180})
+	return t
+}
+
+// Transpose swaps the rows and the columns of the image.
+func (t *Transform) Transpose() *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformTranspose})
+	return t
+}
+
+// Crop keeps the part of the image inside r, in the coordinates of the image
+// produced by the previous operations. r is clipped to the image.
+func (t *Transform) Crop(r Rectangle) *Transform {
+	t.ops = append(t.ops, transformOp{kind: transformCrop, rect: r})
+	return t
+}
+
+// plan composes the operations for a width x height image and returns the
+// resulting mapping and size.
+func (t *Transform) plan(width, height int) (coordMap, int, int, error) {
+	m := coordMap{ax: 1, by: 1}
+	for _, op := range t.ops {
+		var o coordMap
+		switch op.kind {
+		case transformFlip:
+			o = coordMap{ax: -1, cx: width - 1, by: 1}
+		case transformFlop:
+			o = coordMap{ax: 1, by: -1, cy: height - 1}
+		case transformRotate90CW:
+			o = coordMap{bx: 1, ay: -1, cy: height - 1}
+			width, height = height, width
+		case transformRotate90CCW:
+			o = coordMap{bx: -1, cx: width - 1, ay: 1}
+			width, height = height, width
+		case transformRotate180:
+			o = coordMap{ax: -1, cx: width - 1, by: -1, cy: height - 1}
+		case transformTranspose:
+			o = coordMap{bx: 1, ay: 1}
+			width, height = height, width
+		case transformCrop:
+			r := op.rect
+			r.Min.X, r.Min.Y = clampInt(r.Min.X, 0, width), clampInt(r.Min.Y, 0, height)
+			r.Max.X, r.Max.Y = clampInt(r.Max.X, 0, width), clampInt(r.Max.Y, 0, height)
+			if r.Empty() {
+				return coordMap{}, 0, 0, fmt.Errorf("crop %v is outside the %d x %d image", op.rect, width, height)
+			}
+			o = coordMap{ax: 1, cx: r.Min.X, by: 1, cy: r.Min.Y}
+			width, height = r.Dx(), r.Dy()
+		}
+		m = m.then(o)
+	}
+	return m, width, height, nil
+}
+
+// ApplyPBM runs the transform on the PBM image.
+func (t *Transform) ApplyPBM(pbm *PBM) error {
+	m, width, height, err := t.plan(pbm.width, pbm.height)
+	if err != nil {
+		return err
+	}
+	result := newPBM(width, height, pbm.magicNumber)
+	for y := 0; y < height; y++ {
+		sx, sy := m.bx*y+m.cx, m.by*y+m.cy
+		for x := 0; x < width; x++ {
+			result.data[y][x] = pbm.data[sy][sx]
+			sx += m.ax
+			sy += m.ay
+		}
+	}
+	pbm.data, pbm.width, pbm.height = result.data, width, height
+	return nil
+}
+
+// ApplyPGM runs the transform on the PGM image.
+func (t *Transform) ApplyPGM(pgm *PGM) error {
+	m, width, height, err := t.plan(pgm.width, pgm.height)
+	if err != nil {
+		return err
+	}
+	result := newPGM(width, height, pgm.max, pgm.magicNumber)
+	for y := 0; y < height; y++ {
+		sx, sy := m.bx*y+m.cx, m.by*y+m.cy
+		for x := 0; x < width; x++ {
+			result.data[y][x] = pgm.data[sy][sx]
+			sx += m.ax
+			sy += m.ay
+		}
+	}
+	pgm.data, pgm.width, pgm.height = result.data, width, height
+	return nil
+}
+
+// ApplyPPM runs the transform on the PPM image.
+func (t *Transform) ApplyPPM(ppm *PPM) error {
+	m, width, height, err := t.plan(ppm.width, ppm.height)
+	if err != nil {
+		return err
+	}
+	result := newPPM(width, height, ppm.max, ppm.magicNumber)
+	for y := 0; y < height; y++ {
+		sx, sy := m.bx*y+m.cx, m.by*y+m.cy
+		for x := 0; x < width; x++ {
+			result.data[y][x] = ppm.data[sy][sx]
+			sx += m.ax
+			sy += m.ay
+		}
+	}
+	ppm.data, ppm.width, ppm.height = result.data, width, height
+	return nil
+}
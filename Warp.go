@@ -0,0 +1,254 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Interpolation selects how pixel values are sampled between grid positions.
+type Interpolation int
+
+const (
+	// NearestNeighbor takes the value of the closest pixel.
+	NearestNeighbor Interpolation = iota
+	// Bilinear blends the four surrounding pixels.
+	Bilinear
+	// Bicubic uses a Catmull-Rom spline over the surrounding 4x4 pixels.
+	Bicubic
+)
+
+// Matrix is a 3x3 projective transform mapping source coordinates to
+// destination coordinates: (x', y', w') = M * (x, y, 1).
+// An affine transform is a Matrix whose last row is (0, 0, 1).
+type Matrix [3][3]float64
+
+// Identity returns the identity transform.
+func Identity() Matrix {
+	return Matrix{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+// Affine returns the transform described by a 2x3 affine matrix.
+func Affine(a [2][3]float64) Matrix {
+	return Matrix{a[0], a[1], {0, 0, 1}}
+}
+
+// Multiply returns m * n, the transform applying n first and then m.
+func (m Matrix) Multiply(n Matrix) Matrix {
+	var r Matrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return r
+}
+
+// Inverse returns the inverse transform, or an error if m is singular.
+func (m Matrix) Inverse() (Matrix, error) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return Matrix{}, fmt.Errorf("matrix is not invertible")
+	}
+
+	var inv Matrix
+	inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+	return inv, nil
+}
+
+// Apply maps the point (x, y) through the transform.
+// ok is false when the point is mapped to infinity.
+func (m Matrix) Apply(x, y float64) (float64, float64, bool) {
+	w := m[2][0]*x + m[2][1]*y + m[2][2]
+	if math.Abs(w) < 1e-12 {
+		return 0, 0, false
+	}
+	return (m[0][0]*x + m[0][1]*y + m[0][2]) / w, (m[1][0]*x + m[1][1]*y + m[1][2]) / w, true
+}
+
+// EstimateHomography computes the homography mapping each src point onto the
+// dst point with the same index, e.g. the corners of a photographed page onto
+// the corners of an upright rectangle.
+func EstimateHomography(src, dst [4]Point) (Matrix, error) {
+	// Build the 8x8 system A * h = b for h = (a, b, c, d, e, f, g, h), with i = 1
+	var a [8][9]float64
+	for i := 0; i < 4; i++ {
+		x, y := float64(src[i].X), float64(src[i].Y)
+		u, v := float64(dst[i].X), float64(dst[i].Y)
+		a[2*i] = [9]float64{x, y, 1, 0, 0, 0, -u * x, -u * y, u}
+		a[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -v * x, -v * y, v}
+	}
+
+	// Gaussian elimination with partial pivoting
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Matrix{}, fmt.Errorf("degenerate point correspondences")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			factor := a[row][col] / a[col][col]
+			for k := col; k < 9; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+
+	var h [8]float64
+	for i := 0; i < 8; i++ {
+		h[i] = a[i][8] / a[i][i]
+	}
+	return Matrix{{h[0], h[1], h[2]}, {h[3], h[4], h[5]}, {h[6], h[7], 1}}, nil
+}
+
+// sample reads a single channel at the fractional position (x, y).
+// ok is false when the position falls outside the image.
+func sample(get func(x, y int) float64, width, height int, x, y float64, interp Interpolation) (float64, bool) {
+	const eps = 1e-9
+	if x < -0.5 || y < -0.5 || x > float64(width)-0.5 || y > float64(height)-0.5 {
+		return 0, false
+	}
+
+	clampedGet := func(xi, yi int) float64 {
+		return get(clampInt(xi, 0, width-1), clampInt(yi, 0, height-1))
+	}
+
+	switch interp {
+	case Bilinear:
+		x0, y0 := math.Floor(x+eps), math.Floor(y+eps)
+		fx, fy := x-x0, y-y0
+		ix, iy := int(x0), int(y0)
+		top := clampedGet(ix, iy)*(1-fx) + clampedGet(ix+1, iy)*fx
+		bottom := clampedGet(ix, iy+1)*(1-fx) + clampedGet(ix+1, iy+1)*fx
+		return top*(1-fy) + bottom*fy, true
+	case Bicubic:
+		x0, y0 := math.Floor(x+eps), math.Floor(y+eps)
+		fx, fy := x-x0, y-y0
+		ix, iy := int(x0), int(y0)
+		var rows [4]float64
+		for j := -1; j <= 2; j++ {
+			rows[j+1] = catmullRom(clampedGet(ix-1, iy+j), clampedGet(ix, iy+j), clampedGet(ix+1, iy+j), clampedGet(ix+2, iy+j), fx)
+		}
+		return catmullRom(rows[0], rows[1], rows[2], rows[3], fy), true
+	default:
+		return clampedGet(int(math.Floor(x+0.5)), int(math.Floor(y+0.5))), true
+	}
+}
+
+// catmullRom interpolates between p1 and p2 at t in [0, 1].
+func catmullRom(p0, p1, p2, p3, t float64) float64 {
+	return p1 + 0.5*t*(p2-p0+t*(2*p0-5*p1+4*p2-p3+t*(3*(p1-p2)+p3-p0)))
+}
+
+// clampInt limits v to the range [lo, hi].
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// clampUint8 rounds v and limits it to the range [0, max].
+func clampUint8(v float64, max uint8) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= float64(max) {
+		return max
+	}
+	return uint8(v + 0.5)
+}
+
+// Warp resamples the PGM image through the transform m, which maps source
+// coordinates to destination coordinates. The result has the given size, and
+// destination pixels whose source falls outside the image are set to fill.
+func (pgm *PGM) Warp(m Matrix, width, height int, interp Interpolation, fill uint8) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid size: %d x %d", width, height)
+	}
+	inv, err := m.Inverse()
+	if err != nil {
+		return err
+	}
+
+	get := func(x, y int) float64 { return float64(pgm.data[y][x]) }
+	warped := newPGM(width, height, pgm.max, pgm.magicNumber)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			warped.data[y][x] = fill
+			sx, sy, ok := inv.Apply(float64(x), float64(y))
+			if !ok {
+				continue
+			}
+			if v, ok := sample(get, pgm.width, pgm.height, sx, sy, interp); ok {
+				warped.data[y][x] = clampUint8(v, pgm.max)
+			}
+		}
+	}
+
+	// Update the original image with the warped one
+	pgm.data = warped.data
+	pgm.width, pgm.height = width, height
+	return nil
+}
+
+// Warp resamples the PPM image through the transform m, which maps source
+// coordinates to destination coordinates. The result has the given size, and
+// destination pixels whose source falls outside the image are set to fill.
+func (ppm *PPM) Warp(m Matrix, width, height int, interp Interpolation, fill Pixel) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid size: %d x %d", width, height)
+	}
+	inv, err := m.Inverse()
+	if err != nil {
+		return err
+	}
+
+	getR := func(x, y int) float64 { return float64(ppm.data[y][x].R) }
+	getG := func(x, y int) float64 { return float64(ppm.data[y][x].G) }
+	getB := func(x, y int) float64 { return float64(ppm.data[y][x].B) }
+	warped := newPPM(width, height, ppm.max, ppm.magicNumber)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			warped.data[y][x] = fill
+			sx, sy, ok := inv.Apply(float64(x), float64(y))
+			if !ok {
+				continue
+			}
+			r, ok := sample(getR, ppm.width, ppm.height, sx, sy, interp)
+			if !ok {
+				continue
+			}
+			g, _ := sample(getG, ppm.width, ppm.height, sx, sy, interp)
+			b, _ := sample(getB, ppm.width, ppm.height, sx, sy, interp)
+			warped.data[y][x] = Pixel{R: clampUint8(r, ppm.max), G: clampUint8(g, ppm.max), B: clampUint8(b, ppm.max)}
+		}
+	}
+
+	// Update the original image with the warped one
+	ppm.data = warped.data
+	ppm.width, ppm.height = width, height
+	return nil
+}